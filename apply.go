@@ -16,3 +16,31 @@ func Apply(target *any, isSnapshot bool, change *any, doClean bool) bool {
 	*target = snapshot
 	return true
 }
+
+// ApplySmallest is Apply in snapshot mode that leaves in *change whichever of the difference
+// and the snapshot has the smaller encoding (see EncodedSize). isSnapshot reports that *change
+// still holds the snapshot, so the receiver applies it with Apply(target, isSnapshot, change, ...).
+func ApplySmallest(target *any, change *any) (isApplied bool, isSnapshot bool) {
+	snapshot := *change
+	difference := Difference(*target, snapshot)
+
+	if difference == Undefined {
+		*change = Undefined
+		return false, false
+	}
+
+	*target = snapshot
+
+	if !IsChangeCheaper(difference, snapshot) {
+		return true, true
+	}
+
+	*change = difference
+	return true, false
+}
+
+// ApplyAll merges the changes into *target in order. If a change is invalid, *target is left
+// unchanged and the error (wrapping ErrInvalidChange) names the change. The changes are not modified.
+func ApplyAll(target *any, changes []any, doClean bool) error {
+	return Limits{}.ApplyAll(target, changes, doClean)
+}
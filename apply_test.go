@@ -1,7 +1,9 @@
 package cofly_test
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/rnkv/cofly-go"
@@ -101,3 +103,100 @@ func TestApply(t *testing.T) {
 		}
 	})
 }
+
+func TestApplySmallest(t *testing.T) {
+	t.Run("small-edit-keeps-difference", func(t *testing.T) {
+		oldTarget := map[string]any{"title": "a long title that stays the same", "count": 1}
+		snapshot := map[string]any{"title": "a long title that stays the same", "count": 2}
+
+		var target any = cofly.Clone(oldTarget)
+		var change any = cofly.Clone(snapshot)
+
+		isApplied, isSnapshot := cofly.ApplySmallest(&target, &change)
+		if !isApplied || isSnapshot {
+			t.Fatalf("expected a difference, got isApplied=%v isSnapshot=%v", isApplied, isSnapshot)
+		}
+		if !reflect.DeepEqual(change, map[string]any{"count": 2}) || !reflect.DeepEqual(target, snapshot) {
+			t.Fatalf("unexpected change %#v or target %#v", change, target)
+		}
+	})
+
+	t.Run("rewritten-array-keeps-snapshot", func(t *testing.T) {
+		var target any = []any{1, 2, 3}
+		var change any = []any{4, 5, 6}
+
+		isApplied, isSnapshot := cofly.ApplySmallest(&target, &change)
+		if !isApplied || !isSnapshot {
+			t.Fatalf("expected a snapshot, got isApplied=%v isSnapshot=%v", isApplied, isSnapshot)
+		}
+		if !reflect.DeepEqual(change, []any{4, 5, 6}) || !reflect.DeepEqual(target, []any{4, 5, 6}) {
+			t.Fatalf("unexpected change %#v or target %#v", change, target)
+		}
+
+		// The receiver applies it in the mode it was sent in.
+		var replica any = []any{1, 2, 3}
+		if !cofly.Apply(&replica, isSnapshot, &change, true) || !reflect.DeepEqual(replica, target) {
+			t.Fatalf("unexpected replica %#v", replica)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		var target any = map[string]any{"a": 1}
+		var change any = map[string]any{"a": 1.0}
+
+		isApplied, isSnapshot := cofly.ApplySmallest(&target, &change)
+		if isApplied || isSnapshot || change != cofly.Undefined {
+			t.Fatalf("expected no change, got isApplied=%v isSnapshot=%v change=%#v", isApplied, isSnapshot, change)
+		}
+	})
+}
+
+func TestApplyAll(t *testing.T) {
+	t.Run("applies-in-order", func(t *testing.T) {
+		var target any = map[string]any{"count": 1, "list": []any{"a"}}
+		changes := []any{
+			map[string]any{"count": cofly.Increment(1), "new": map[string]any{"x": 1}},
+			map[string]any{"list": map[string]any{"1..": []any{"b"}}, "new": map[string]any{"y": 2}},
+		}
+		changesBefore := cofly.Clone(changes)
+
+		if err := cofly.ApplyAll(&target, changes, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := map[string]any{"count": 2, "list": []any{"a", "b"}, "new": map[string]any{"x": 1, "y": 2}}
+		if !reflect.DeepEqual(target, want) {
+			t.Fatalf("expected %#v, got %#v", want, target)
+		}
+		if !reflect.DeepEqual(changes, changesBefore) {
+			t.Fatalf("changes were modified: %#v", changes)
+		}
+	})
+
+	t.Run("invalid-change-rolls-back", func(t *testing.T) {
+		original := map[string]any{"count": 1, "nested": map[string]any{"list": []any{"a", "b"}}}
+
+		for name, invalid := range map[string]any{
+			"overlapping-spans":    map[string]any{"nested": map[string]any{"list": map[string]any{"0..2": []any{}, "1..2": []any{}}}},
+			"out-of-range-span":    map[string]any{"nested": map[string]any{"list": map[string]any{"5..": []any{"x"}}}},
+			"unsupported-type":     map[string]any{"nested": struct{}{}},
+			"splices-on-non-array": map[string]any{"count": map[string]any{"0..1": []any{}}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				var target any = cofly.Clone(original)
+				changes := []any{
+					map[string]any{"count": 2, "nested": map[string]any{"extra": true}},
+					invalid,
+				}
+
+				err := cofly.ApplyAll(&target, changes, true)
+				if !errors.Is(err, cofly.ErrInvalidChange) || !strings.Contains(err.Error(), "change 1") {
+					t.Fatalf("expected ErrInvalidChange for change 1, got %v", err)
+				}
+				if !reflect.DeepEqual(target, original) {
+					t.Fatalf("target changed: %#v", target)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package cofly
+
+// ArrayChange builds an array change splice by splice. Positions always refer to
+// the array the change will be applied to, not to the result of earlier calls.
+type ArrayChange struct {
+	splices Splices
+}
+
+func NewArrayChange() *ArrayChange {
+	return &ArrayChange{}
+}
+
+// Replace replaces the elements in [from, to) with values. Like in the splice-maps
+// produced by Difference, values that land on existing elements are merged into them.
+func (c *ArrayChange) Replace(from, to int, values ...any) *ArrayChange {
+	if values == nil {
+		values = make([]any, 0)
+	}
+
+	c.splices = append(c.splices, Splice{From: from, To: to, Values: values})
+	return c
+}
+
+func (c *ArrayChange) Insert(at int, values ...any) *ArrayChange {
+	return c.Replace(at, at, values...)
+}
+
+func (c *ArrayChange) Delete(from, to int) *ArrayChange {
+	return c.Replace(from, to)
+}
+
+func (c *ArrayChange) BuildSplices() (Splices, error) {
+	if err := c.splices.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.splices.sorted(), nil
+}
+
+func (c *ArrayChange) Build() (map[string]any, error) {
+	splices, err := c.BuildSplices()
+	if err != nil {
+		return nil, err
+	}
+
+	return splices.Map(), nil
+}
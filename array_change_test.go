@@ -0,0 +1,140 @@
+package cofly_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestArrayChange(t *testing.T) {
+	t.Run("build-splice-map", func(t *testing.T) {
+		change, err := cofly.NewArrayChange().
+			Replace(1, 2, "B").
+			Insert(3, "x", "y").
+			Delete(5, 7).
+			Build()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := map[string]any{
+			"1..2": []any{"B"},
+			"3..":  []any{"x", "y"},
+			"5..7": []any{},
+		}
+		if !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		target := []any{"a", "b", "c", "d", "e", "f", "g", "h"}
+		got := cofly.Merge(target, change, true)
+		if wantArray := []any{"a", "B", "c", "x", "y", "d", "e", "h"}; !reflect.DeepEqual(got, wantArray) {
+			t.Fatalf("expected %#v, got %#v", wantArray, got)
+		}
+	})
+
+	t.Run("insert-before-replace-at-same-index", func(t *testing.T) {
+		change, err := cofly.NewArrayChange().Replace(1, 2, "B").Insert(1, "x").Build()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := cofly.Merge([]any{"a", "b", "c"}, change, true)
+		if want := []any{"a", "x", "B", "c"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("build-splices-sorted", func(t *testing.T) {
+		splices, err := cofly.NewArrayChange().Delete(4, 5).Insert(0, "x").Build()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(splices) != 2 {
+			t.Fatalf("unexpected splices: %#v", splices)
+		}
+
+		compact, err := cofly.NewArrayChange().Delete(4, 5).Insert(0, "x").BuildSplices()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := cofly.Splices{
+			{From: 0, To: 0, Values: []any{"x"}},
+			{From: 4, To: 5, Values: []any{}},
+		}
+		if !reflect.DeepEqual(compact, want) {
+			t.Fatalf("expected %#v, got %#v", want, compact)
+		}
+	})
+
+	t.Run("rejects-invalid-changes", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			change *cofly.ArrayChange
+		}{
+			{"overlap", cofly.NewArrayChange().Replace(1, 3, "x").Delete(2, 4)},
+			{"duplicate-insert", cofly.NewArrayChange().Insert(2, "x").Insert(2, "y")},
+			{"negative", cofly.NewArrayChange().Delete(-1, 1)},
+			{"reversed", cofly.NewArrayChange().Delete(3, 1)},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				if _, err := tc.change.Build(); err == nil {
+					t.Fatalf("expected error")
+				}
+			})
+		}
+	})
+}
+
+func TestParseSpan(t *testing.T) {
+	span, ok := cofly.ParseSpan("3..7")
+	if !ok || span != (cofly.Span{From: 3, To: 7}) {
+		t.Fatalf("unexpected span: %#v (ok=%v)", span, ok)
+	}
+	if span.String() != "3..7" {
+		t.Fatalf("unexpected string: %q", span.String())
+	}
+
+	if span := (cofly.Span{From: 4, To: 4}); span.String() != "4.." {
+		t.Fatalf("unexpected string: %q", span.String())
+	}
+
+	for _, key := range []string{"7..3", "-1..2", "x", "1"} {
+		if _, ok := cofly.ParseSpan(key); ok {
+			t.Fatalf("expected %q to be invalid", key)
+		}
+	}
+}
+
+func TestParseSplices(t *testing.T) {
+	splices, ok := cofly.ParseSplices(map[string]any{"3..": []any{"d"}, "1..2": []any{"B"}})
+	if !ok {
+		t.Fatalf("expected ok=true")
+	}
+
+	want := cofly.Splices{
+		{From: 1, To: 2, Values: []any{"B"}},
+		{From: 3, To: 3, Values: []any{"d"}},
+	}
+	if !reflect.DeepEqual(splices, want) {
+		t.Fatalf("expected %#v, got %#v", want, splices)
+	}
+	if err := splices.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := cofly.ParseSplices(map[string]any{"a": []any{}}); ok {
+		t.Fatalf("expected ok=false for non-span keys")
+	}
+	if _, ok := cofly.ParseSplices(map[string]any{}); ok {
+		t.Fatalf("expected ok=false for empty map")
+	}
+
+	overlapping, _ := cofly.ParseSplices(map[string]any{"0..2": []any{}, "1..3": []any{}})
+	if err := overlapping.Validate(); err == nil {
+		t.Fatalf("expected overlap error")
+	}
+}
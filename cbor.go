@@ -0,0 +1,525 @@
+package cofly
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	cborMajorUint     = 0
+	cborMajorNegative = 1
+	cborMajorBytes    = 2
+	cborMajorText     = 3
+	cborMajorArray    = 4
+	cborMajorMap      = 5
+	cborMajorTag      = 6
+	cborMajorSimple   = 7
+)
+
+const (
+	cborFalse     = 0xf4
+	cborTrue      = 0xf5
+	cborNull      = 0xf6
+	cborUndefined = 0xf7
+)
+
+// cborTagDateTime tags RFC 3339 date/time strings.
+const cborTagDateTime = 0
+
+// cborIndefinite is the additional information value for indefinite-length items.
+const cborIndefinite = 31
+
+var (
+	errCBORTruncated = errors.New("invalid cbor: unexpected end of data")
+	errCBORTooDeep   = errors.New("invalid cbor: nesting is too deep")
+)
+
+func MarshalCBOR(change any) ([]byte, error) {
+	return appendCBOR(nil, change)
+}
+
+func UnmarshalCBOR(data []byte) (any, error) {
+	decoder := cborDecoder{data: data}
+
+	value, err := decoder.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if value == cborBreakMarker {
+		return nil, errors.New("invalid cbor: unexpected break")
+	}
+
+	if decoder.offset != len(data) {
+		return nil, errors.New("invalid cbor: unexpected data after top-level value")
+	}
+
+	return value, nil
+}
+
+func appendCBOR(buffer []byte, value any) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(buffer, cborNull), nil
+	case bool:
+		if value {
+			return append(buffer, cborTrue), nil
+		}
+
+		return append(buffer, cborFalse), nil
+	case int, int8, int16, int32, int64:
+		return appendCBORInt(buffer, toInt64(value)), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return appendCBORHead(buffer, cborMajorUint, toUint64(value)), nil
+	case float32:
+		buffer = append(buffer, 0xfa)
+		return binary.BigEndian.AppendUint32(buffer, math.Float32bits(value)), nil
+	case float64:
+		buffer = append(buffer, 0xfb)
+		return binary.BigEndian.AppendUint64(buffer, math.Float64bits(value)), nil
+	case string:
+		if value == Undefined {
+			return append(buffer, cborUndefined), nil
+		}
+
+		buffer = appendCBORHead(buffer, cborMajorText, uint64(len(value)))
+		return append(buffer, value...), nil
+	case []byte:
+		if value == nil {
+			return append(buffer, cborNull), nil
+		}
+
+		buffer = appendCBORHead(buffer, cborMajorBytes, uint64(len(value)))
+		return append(buffer, value...), nil
+	case time.Time:
+		text, err := value.UTC().MarshalText()
+		if err != nil {
+			return nil, err
+		}
+
+		buffer = appendCBORHead(buffer, cborMajorTag, cborTagDateTime)
+		buffer = appendCBORHead(buffer, cborMajorText, uint64(len(text)))
+		return append(buffer, text...), nil
+	case map[string]any:
+		if value == nil {
+			return append(buffer, cborNull), nil
+		}
+
+		buffer = appendCBORHead(buffer, cborMajorMap, uint64(len(value)))
+
+		if splices := parseSplices(value); len(splices) > 0 {
+			sortSplices(splices)
+
+			for _, splice := range splices {
+				buffer = appendCBORHead(buffer, cborMajorArray, 2)
+				buffer = appendCBORInt(buffer, int64(splice.span.indexFrom))
+				buffer = appendCBORInt(buffer, int64(splice.span.indexTo))
+
+				var err error
+				buffer, err = appendCBOR(buffer, splice.value)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return buffer, nil
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			buffer = appendCBORHead(buffer, cborMajorText, uint64(len(key)))
+			buffer = append(buffer, key...)
+
+			var err error
+			buffer, err = appendCBOR(buffer, value[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return buffer, nil
+	case []any:
+		if value == nil {
+			return append(buffer, cborNull), nil
+		}
+
+		buffer = appendCBORHead(buffer, cborMajorArray, uint64(len(value)))
+
+		for _, element := range value {
+			var err error
+			buffer, err = appendCBOR(buffer, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return buffer, nil
+	case Splices:
+		if value == nil {
+			return appendCBOR(buffer, nil)
+		}
+
+		return appendCBOR(buffer, value.Map())
+	default:
+		if value, ok := normalizeCollection(value); ok {
+			return appendCBOR(buffer, value)
+		}
+
+		if isLeaf(value) {
+			value, err := leafValue(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return appendCBOR(buffer, value)
+		}
+
+		return nil, fmt.Errorf("type [%T] unsupported", value)
+	}
+}
+
+func appendCBORInt(buffer []byte, value int64) []byte {
+	if value < 0 {
+		return appendCBORHead(buffer, cborMajorNegative, uint64(-1-value))
+	}
+
+	return appendCBORHead(buffer, cborMajorUint, uint64(value))
+}
+
+func appendCBORHead(buffer []byte, major byte, argument uint64) []byte {
+	major <<= 5
+
+	switch {
+	case argument < 24:
+		return append(buffer, major|byte(argument))
+	case argument <= math.MaxUint8:
+		return append(buffer, major|24, byte(argument))
+	case argument <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, major|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buffer, major|26), uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64(append(buffer, major|27), argument)
+	}
+}
+
+type cborBreakType struct{}
+
+// cborBreakMarker is returned by decodeValue when it reads the "break" stop code
+// of an indefinite-length item.
+var cborBreakMarker = cborBreakType{}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+	depth  int
+}
+
+func (d *cborDecoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.offset < n {
+		return nil, errCBORTruncated
+	}
+
+	bytes := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return bytes, nil
+}
+
+func (d *cborDecoder) readHead() (major byte, info byte, argument uint64, err error) {
+	initial, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info = initial[0]>>5, initial[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		bytes, err := d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		switch len(bytes) {
+		case 1:
+			argument = uint64(bytes[0])
+		case 2:
+			argument = uint64(binary.BigEndian.Uint16(bytes))
+		case 4:
+			argument = uint64(binary.BigEndian.Uint32(bytes))
+		default:
+			argument = binary.BigEndian.Uint64(bytes)
+		}
+
+		return major, info, argument, nil
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid cbor: reserved additional information %d", info)
+	}
+}
+
+func (d *cborDecoder) length(argument uint64) (int, error) {
+	if argument > uint64(len(d.data)-d.offset) {
+		return 0, errCBORTruncated
+	}
+
+	return int(argument), nil
+}
+
+func (d *cborDecoder) decodeValue() (any, error) {
+	major, info, argument, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if info == cborIndefinite && (major == cborMajorUint || major == cborMajorNegative || major == cborMajorTag) {
+		return nil, errors.New("invalid cbor: indefinite length not allowed here")
+	}
+
+	switch major {
+	case cborMajorUint:
+		if argument > math.MaxInt64 {
+			return argument, nil
+		}
+
+		return int(argument), nil
+	case cborMajorNegative:
+		if argument > math.MaxInt64 {
+			return nil, errors.New("invalid cbor: negative integer overflows int64")
+		}
+
+		return int(-1 - int64(argument)), nil
+	case cborMajorBytes, cborMajorText:
+		bytes, err := d.decodeString(major, info, argument)
+		if err != nil {
+			return nil, err
+		}
+
+		if major == cborMajorBytes {
+			return slices.Clone(bytes), nil
+		}
+
+		return string(bytes), nil
+	case cborMajorArray:
+		return d.decodeArray(info, argument)
+	case cborMajorMap:
+		return d.decodeMap(info, argument)
+	case cborMajorTag:
+		if argument != cborTagDateTime {
+			return nil, fmt.Errorf("invalid cbor: unsupported tag %d", argument)
+		}
+
+		if d.depth++; d.depth > maxDecodingDepth {
+			return nil, errCBORTooDeep
+		}
+		defer func() { d.depth-- }()
+
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			return nil, errors.New("invalid cbor: date/time is not a text string")
+		}
+
+		dateTime, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cbor: date/time: %w", err)
+		}
+
+		return dateTime, nil
+	default:
+		return d.decodeSimple(info, argument)
+	}
+}
+
+func (d *cborDecoder) decodeSimple(info byte, argument uint64) (any, error) {
+	switch info {
+	case cborFalse & 0x1f:
+		return false, nil
+	case cborTrue & 0x1f:
+		return true, nil
+	case cborNull & 0x1f:
+		return nil, nil
+	case cborUndefined & 0x1f:
+		return Undefined, nil
+	case 25:
+		return halfToFloat32(uint16(argument)), nil
+	case 26:
+		return math.Float32frombits(uint32(argument)), nil
+	case 27:
+		return math.Float64frombits(argument), nil
+	case cborIndefinite:
+		return cborBreakMarker, nil
+	default:
+		return nil, fmt.Errorf("invalid cbor: unsupported simple value %d", argument)
+	}
+}
+
+func (d *cborDecoder) decodeString(major, info byte, argument uint64) ([]byte, error) {
+	if info != cborIndefinite {
+		length, err := d.length(argument)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.read(length)
+	}
+
+	var bytes []byte
+
+	for {
+		chunkMajor, chunkInfo, chunkArgument, err := d.readHead()
+		if err != nil {
+			return nil, err
+		}
+
+		if chunkMajor == cborMajorSimple && chunkInfo == cborIndefinite {
+			return bytes, nil
+		}
+
+		if chunkMajor != major || chunkInfo == cborIndefinite {
+			return nil, errors.New("invalid cbor: malformed indefinite-length string")
+		}
+
+		length, err := d.length(chunkArgument)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk, err := d.read(length)
+		if err != nil {
+			return nil, err
+		}
+
+		bytes = append(bytes, chunk...)
+	}
+}
+
+func (d *cborDecoder) decodeArray(info byte, argument uint64) (any, error) {
+	if d.depth++; d.depth > maxDecodingDepth {
+		return nil, errCBORTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	if info == cborIndefinite {
+		array := make([]any, 0)
+
+		for {
+			element, err := d.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+
+			if element == cborBreakMarker {
+				return array, nil
+			}
+
+			array = append(array, element)
+		}
+	}
+
+	length, err := d.length(argument)
+	if err != nil {
+		return nil, err
+	}
+
+	array := make([]any, 0, length)
+
+	for range length {
+		element, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if element == cborBreakMarker {
+			return nil, errors.New("invalid cbor: unexpected break")
+		}
+
+		array = append(array, element)
+	}
+
+	return array, nil
+}
+
+func (d *cborDecoder) decodeMap(info byte, argument uint64) (any, error) {
+	if d.depth++; d.depth > maxDecodingDepth {
+		return nil, errCBORTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	length := -1
+
+	if info != cborIndefinite {
+		var err error
+		length, err = d.length(argument)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	object := make(map[string]any, max(length, 0))
+
+	for index := 0; length < 0 || index < length; index++ {
+		key, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if key == cborBreakMarker && length < 0 {
+			return object, nil
+		}
+
+		keyString, err := decodeBinaryKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		if value == cborBreakMarker {
+			return nil, errors.New("invalid cbor: unexpected break")
+		}
+
+		object[keyString] = value
+	}
+
+	return object, nil
+}
+
+func halfToFloat32(half uint16) float32 {
+	sign := uint32(half>>15) << 31
+	exponent := uint32(half>>10) & 0x1f
+	mantissa := uint32(half) & 0x3ff
+
+	switch exponent {
+	case 0:
+		value := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			return -value
+		}
+
+		return value
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	default:
+		return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+	}
+}
@@ -0,0 +1,124 @@
+package cofly_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestCBOR(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		change := map[string]any{
+			"nil":    nil,
+			"bools":  []any{true, false},
+			"ints":   []any{0, 23, 24, 255, 256, -1, -24, -25, 70000, -70000, 1 << 40, -(1 << 40)},
+			"uint":   uint64(1 << 63),
+			"f32":    float32(1.5),
+			"f64":    2.25,
+			"long":   strings.Repeat("x", 300),
+			"gone":   cofly.Undefined,
+			"list":   map[string]any{"1..2": []any{"B"}, "3..": []any{}, "10..12": []any{map[string]any{"a": 1}}},
+			"nested": map[string]any{"1..2": "not-a-splice"},
+		}
+
+		data, err := cofly.MarshalCBOR(change)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := cofly.UnmarshalCBOR(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, change) {
+			t.Fatalf("expected %#v, got %#v", change, got)
+		}
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			change any
+			want   []byte
+		}{
+			{"undefined", cofly.Undefined, []byte{0xf7}},
+			{"small-int", 10, []byte{0x0a}},
+			{"negative-int", -500, []byte{0x39, 0x01, 0xf3}},
+			{"text", "ab", []byte{0x62, 'a', 'b'}},
+			{"span-keys-as-pairs", map[string]any{"3..": []any{1}, "1..2": []any{}}, []byte{
+				0xa2,
+				0x82, 0x01, 0x02, 0x80,
+				0x82, 0x03, 0x03, 0x81, 0x01,
+			}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				got, err := cofly.MarshalCBOR(tc.change)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !bytes.Equal(got, tc.want) {
+					t.Fatalf("expected % x, got % x", tc.want, got)
+				}
+			})
+		}
+	})
+
+	t.Run("decodes-indefinite-lengths-and-half-floats", func(t *testing.T) {
+		data := []byte{
+			0xbf,                             // indefinite map
+			0x7f, 0x61, 'a', 0x61, 'b', 0xff, // indefinite text "ab"
+			0x9f, 0xf9, 0x3e, 0x00, 0xf7, 0xff, // indefinite array [1.5 (half), undefined]
+			0xff,
+		}
+		want := map[string]any{"ab": []any{float32(1.5), cofly.Undefined}}
+
+		got, err := cofly.UnmarshalCBOR(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("invalid-input-errors", func(t *testing.T) {
+		for _, data := range [][]byte{
+			{},
+			{0xff},
+			{0x82, 0x01},
+			{0x63, 'a'},
+			{0xa1, 0x01, 0x01},
+			{0xc1, 0x01},
+			{0x01, 0x02},
+			{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		} {
+			if _, err := cofly.UnmarshalCBOR(data); err == nil {
+				t.Fatalf("expected error for % x", data)
+			}
+		}
+	})
+
+	t.Run("deep-nesting-errors", func(t *testing.T) {
+		for _, prefix := range [][]byte{{0x81}, {0xa1, 0x61, 'a'}} {
+			data := append(bytes.Repeat(prefix, 1<<20), 0x01)
+			if _, err := cofly.UnmarshalCBOR(data); err == nil {
+				t.Fatalf("expected error for nested % x", prefix)
+			}
+
+			data = append(bytes.Repeat(prefix, 1000), 0x01)
+			if _, err := cofly.UnmarshalCBOR(data); err != nil {
+				t.Fatalf("unexpected error for nested % x: %v", prefix, err)
+			}
+		}
+
+		data := append(bytes.Repeat([]byte{0xc0}, 1<<20), 0x01)
+		if _, err := cofly.UnmarshalCBOR(data); err == nil || !strings.Contains(err.Error(), "too deep") {
+			t.Fatalf("expected nesting error for nested tags, got %v", err)
+		}
+	})
+}
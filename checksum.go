@@ -0,0 +1,26 @@
+package cofly
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// ErrUnhashable is returned by TryChecksum for values that contain unsupported types or Differ values.
+var ErrUnhashable = errors.New("value cannot be hashed")
+
+// Checksum returns the hex-encoded Hash of the value.
+// Equal values have equal checksums. It panics on unsupported types.
+func Checksum(value any) string {
+	sum := Hash(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// TryChecksum is like Checksum, but returns ErrUnhashable instead of panicking.
+func TryChecksum(value any) (string, error) {
+	sum, ok := hashValue(value)
+	if !ok {
+		return "", ErrUnhashable
+	}
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -15,8 +15,22 @@ func Clone(value any) any {
 		return cloneMap(value)
 	case []any:
 		return cloneArray(value)
+	case Splices:
+		return cloneSplices(value)
 	default:
-		panic(fmt.Sprintf("type [%T] unsupported", value))
+		if cloner, ok := value.(Cloner); ok {
+			return cloner.CoflyClone()
+		}
+
+		if _, ok := asDiffer(value); ok {
+			return value
+		}
+
+		if isLeaf(value) {
+			return cloneLeaf(value)
+		}
+
+		return cloneCollection(value)
 	}
 }
 
@@ -39,3 +53,32 @@ func cloneArray(sourceArray []any) []any {
 
 	return clonedArray
 }
+
+func cloneSplices(sourceSplices Splices) Splices {
+	if sourceSplices == nil {
+		return nil
+	}
+
+	clonedSplices := make(Splices, len(sourceSplices))
+
+	for index, splice := range sourceSplices {
+		clonedSplices[index] = Splice{
+			From:   splice.From,
+			To:     splice.To,
+			Values: cloneArray(splice.Values),
+		}
+	}
+
+	return clonedSplices
+}
+
+// tryClone clones a change, reporting unsupported types as an invalid change.
+func tryClone(change any) (output any, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidChange, recovered)
+		}
+	}()
+
+	return Clone(change), nil
+}
@@ -0,0 +1,237 @@
+// Command cofly computes, applies and composes cofly changes of JSON documents.
+//
+//	cofly diff [flags] old.json new.json
+//	cofly patch target.json change.json
+//	cofly compose first.json second.json
+//	cofly validate target.json change.json
+//
+// A file name of "-" reads standard input.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rnkv/cofly-go"
+)
+
+const usage = `usage:
+  cofly diff [flags] old.json new.json     print the change from old to new
+  cofly patch target.json change.json      print target with the change applied
+  cofly compose first.json second.json     print the change equivalent to first then second
+  cofly validate target.json change.json   check that the change applies to target
+
+A file name of "-" reads standard input.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	command, args := args[0], args[1:]
+
+	var err error
+	switch command {
+	case "diff":
+		err = runDiff(args, stdin, stdout, stderr)
+	case "patch":
+		err = runPatch(args, stdin, stdout)
+	case "compose":
+		err = runCompose(args, stdin, stdout)
+	case "validate":
+		err = runValidate(args, stdin, stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", command))
+	}
+
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "cofly: %s\n\n%s", err, usage)
+		return 2
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "cofly: %s\n", err)
+		return 1
+	}
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+type pathsFlag []string
+
+func (f *pathsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *pathsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var options cofly.DifferenceOptions
+
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&options.CompactSplices, "compact", false, "emit compact splices")
+	flags.BoolVar(&options.Increments, "increments", false, "emit numeric changes as increments")
+	flags.IntVar(&options.StringSpliceThreshold, "string-splices", 0, "emit string splices for strings of at least `n` bytes")
+	flags.Var((*pathsFlag)(&options.UnorderedPaths), "unordered", "treat arrays matching the JSON Pointer `pattern` as sets (repeatable)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	values, err := readValues(flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range options.UnorderedPaths {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return usageError(fmt.Sprintf("invalid -unordered pattern %q: must start with \"/\"", path))
+		}
+	}
+
+	return writeValue(stdout, cofly.DifferenceWithOptions(values[0], values[1], options))
+}
+
+func runPatch(args []string, stdin io.Reader, stdout io.Writer) error {
+	target, change, err := readTargetAndChange(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	output, err := cofly.MergeJSON(target, bytes.NewReader(change), true)
+	if err != nil {
+		return err
+	}
+
+	return writeValue(stdout, output)
+}
+
+func runCompose(args []string, stdin io.Reader, stdout io.Writer) error {
+	values, err := readValues(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	composed, err := cofly.Compose(values[0], values[1])
+	if err != nil {
+		return err
+	}
+
+	return writeValue(stdout, composed)
+}
+
+func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	target, change, err := readTargetAndChange(args, stdin)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cofly.MergeJSON(target, bytes.NewReader(change), true); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(stdout, "ok")
+	return err
+}
+
+func readTargetAndChange(args []string, stdin io.Reader) (any, []byte, error) {
+	if len(args) != 2 {
+		return nil, nil, usageError("expected two files")
+	}
+
+	if args[0] == "-" && args[1] == "-" {
+		return nil, nil, usageError("only one file can be read from standard input")
+	}
+
+	target, err := readValue(args[0], stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	change, err := readFile(args[1], stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return target, change, nil
+}
+
+func readValues(args []string, stdin io.Reader) ([2]any, error) {
+	if len(args) != 2 {
+		return [2]any{}, usageError("expected two files")
+	}
+
+	if args[0] == "-" && args[1] == "-" {
+		return [2]any{}, usageError("only one file can be read from standard input")
+	}
+
+	var values [2]any
+	for index, name := range args {
+		value, err := readValue(name, stdin)
+		if err != nil {
+			return [2]any{}, err
+		}
+
+		values[index] = value
+	}
+
+	return values, nil
+}
+
+func readValue(name string, stdin io.Reader) (any, error) {
+	data, err := readFile(name, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := cofly.UnmarshalChange(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return value, nil
+}
+
+func readFile(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(stdin)
+	}
+
+	return os.ReadFile(name)
+}
+
+func writeValue(w io.Writer, value any) error {
+	data, err := cofly.MarshalChange(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
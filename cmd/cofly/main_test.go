@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	directory := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(directory, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return path
+	}
+
+	oldFile := write("old.json", `{"a":1,"b":[1,2,3],"c":"x"}`)
+	newFile := write("new.json", `{"a":2,"b":[1,3,4]}`)
+	change := write("change.json", `{"a":2,"b":{"1..2":[],"3..":[4]},"c":"\u0000"}`)
+	invalid := write("invalid.json", `{"b":{"7..":[1]}}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		code     int
+		stdout   string
+		stderrIn string
+	}{
+		{name: "diff", args: []string{"diff", oldFile, newFile}, stdout: `{"a":2,"b":{"1..2":[],"3..":[4]},"c":"\u0000"}` + "\n"},
+		{name: "diff-increments", args: []string{"diff", "-increments", oldFile, newFile}, stdout: `{"a":{"$inc":1},"b":{"1..2":[],"3..":[4]},"c":"\u0000"}` + "\n"},
+		{name: "diff-unordered", args: []string{"diff", "-unordered", "/b", oldFile, newFile}, stdout: `{"a":2,"b":{"$add":[4],"$remove":[2]},"c":"\u0000"}` + "\n"},
+		{name: "diff-stdin", args: []string{"diff", "-", newFile}, stdin: `{"a":2,"b":[1,3,4]}`, stdout: `"\u0000"` + "\n"},
+		{name: "patch", args: []string{"patch", oldFile, change}, stdout: `{"a":2,"b":[1,3,4]}` + "\n"},
+		{name: "patch-stdin", args: []string{"patch", oldFile, "-"}, stdin: `{"c":"y"}`, stdout: `{"a":1,"b":[1,2,3],"c":"y"}` + "\n"},
+		{name: "compose", args: []string{"compose", change, "-"}, stdin: `{"b":{"0..1":[]}}`, stdout: `{"a":2,"b":{"0..2":[],"3..":[4]},"c":"\u0000"}` + "\n"},
+		{name: "validate", args: []string{"validate", oldFile, change}, stdout: "ok\n"},
+		{name: "validate-invalid", args: []string{"validate", oldFile, invalid}, code: 1, stderrIn: "invalid change"},
+		{name: "missing-file", args: []string{"patch", oldFile, filepath.Join(directory, "missing.json")}, code: 1, stderrIn: "missing.json"},
+		{name: "invalid-json", args: []string{"diff", "-", newFile}, stdin: `{`, code: 1, stderrIn: "-:"},
+		{name: "unknown-command", args: []string{"merge"}, code: 2, stderrIn: "unknown command"},
+		{name: "wrong-arguments", args: []string{"diff", oldFile}, code: 2, stderrIn: "expected two files"},
+		{name: "two-stdin", args: []string{"compose", "-", "-"}, code: 2, stderrIn: "standard input"},
+		{name: "no-arguments", args: nil, code: 2, stderrIn: "usage:"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+			if code != test.code {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", test.code, code, stderr.String())
+			}
+			if test.stdout != "" && stdout.String() != test.stdout {
+				t.Fatalf("expected stdout %q, got %q", test.stdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), test.stderrIn) {
+				t.Fatalf("expected stderr to contain %q, got %q", test.stderrIn, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package cofly
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// normalizeCollection converts a typed slice or a typed map with string keys
+// ([]string, []map[string]any, map[string]int, ...) into []any or map[string]any, one level deep.
+// It returns false for every other value, including []any and map[string]any.
+func normalizeCollection(value any) (any, bool) {
+	switch value.(type) {
+	case nil,
+		bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64,
+		string,
+		map[string]any,
+		[]any,
+		Splices:
+		return nil, false
+	}
+
+	if _, ok := asDiffer(value); ok || isLeaf(value) {
+		return nil, false
+	}
+
+	reflectValue := reflect.ValueOf(value)
+
+	switch reflectValue.Kind() {
+	case reflect.Slice:
+		if reflectValue.IsNil() {
+			return []any(nil), true
+		}
+
+		array := make([]any, reflectValue.Len())
+
+		for index := range array {
+			array[index] = reflectValue.Index(index).Interface()
+		}
+
+		return array, true
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		if reflectValue.IsNil() {
+			return map[string]any(nil), true
+		}
+
+		object := make(map[string]any, reflectValue.Len())
+
+		for iterator := reflectValue.MapRange(); iterator.Next(); {
+			object[iterator.Key().String()] = iterator.Value().Interface()
+		}
+
+		return object, true
+	default:
+		return nil, false
+	}
+}
+
+// normalize returns the value converted by normalizeCollection, or the value itself.
+func normalize(value any) any {
+	if collection, ok := normalizeCollection(value); ok {
+		return collection
+	}
+
+	return value
+}
+
+// cloneCollection deeply copies a typed slice or map, keeping its type.
+func cloneCollection(value any) any {
+	if _, ok := normalizeCollection(value); !ok {
+		panic(fmt.Sprintf("type [%T] unsupported", value))
+	}
+
+	reflectValue := reflect.ValueOf(value)
+
+	if reflectValue.IsNil() {
+		return value
+	}
+
+	switch reflectValue.Kind() {
+	case reflect.Slice:
+		clonedValue := reflect.MakeSlice(reflectValue.Type(), reflectValue.Len(), reflectValue.Len())
+
+		for index := range reflectValue.Len() {
+			if element := Clone(reflectValue.Index(index).Interface()); element != nil {
+				clonedValue.Index(index).Set(reflect.ValueOf(element))
+			}
+		}
+
+		return clonedValue.Interface()
+	default:
+		clonedValue := reflect.MakeMapWithSize(reflectValue.Type(), reflectValue.Len())
+
+		for iterator := reflectValue.MapRange(); iterator.Next(); {
+			element := reflect.Zero(reflectValue.Type().Elem())
+			if clonedElement := Clone(iterator.Value().Interface()); clonedElement != nil {
+				element = reflect.ValueOf(clonedElement)
+			}
+
+			clonedValue.SetMapIndex(iterator.Key(), element)
+		}
+
+		return clonedValue.Interface()
+	}
+}
@@ -0,0 +1,124 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+type tags []string
+
+func TestTypedCollectionsEqual(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldValue any
+		newValue any
+		expected bool
+	}{
+		{"string-slices", []string{"a", "b"}, []string{"a", "b"}, true},
+		{"string-slice-and-array", []string{"a", "b"}, []any{"a", "b"}, true},
+		{"int-slice-and-floats", []int{1, 2}, []any{1.0, 2.0}, true},
+		{"named-slice", tags{"a"}, []any{"a"}, true},
+		{"different-elements", []string{"a", "b"}, []string{"a", "c"}, false},
+		{"string-map", map[string]string{"a": "x"}, map[string]any{"a": "x"}, true},
+		{"nested", []map[string]any{{"a": []int{1}}}, []any{map[string]any{"a": []any{1}}}, true},
+		{"map-and-slice", map[string]int{}, []int{}, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := cofly.Equal(testCase.oldValue, testCase.newValue); actual != testCase.expected {
+				t.Fatalf("expected %v, got %v", testCase.expected, actual)
+			}
+
+			if actual := cofly.Equal(testCase.newValue, testCase.oldValue); actual != testCase.expected {
+				t.Fatalf("expected %v reversed, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTypedCollectionsClone(t *testing.T) {
+	source := map[string][]map[string]any{"a": {{"b": []string{"c"}}}}
+
+	cloned, ok := cofly.Clone(source).(map[string][]map[string]any)
+	if !ok {
+		t.Fatalf("expected the type to be kept, got %T", cofly.Clone(source))
+	}
+	if !reflect.DeepEqual(cloned, source) {
+		t.Fatalf("expected %#v, got %#v", source, cloned)
+	}
+
+	cloned["a"][0]["b"].([]string)[0] = "changed"
+	if source["a"][0]["b"].([]string)[0] != "c" {
+		t.Fatalf("clone shares memory with the source")
+	}
+
+	if cloned := cofly.Clone(tags(nil)); cloned.(tags) != nil {
+		t.Fatalf("expected nil, got %#v", cloned)
+	}
+}
+
+func TestTypedCollectionsDifferenceAndMerge(t *testing.T) {
+	oldValue := map[string]any{"tags": []string{"a", "b", "c"}, "meta": map[string]string{"x": "1", "y": "2"}}
+	newValue := map[string]any{"tags": []string{"a", "c", "d"}, "meta": map[string]string{"x": "1", "y": "3"}}
+
+	if change := cofly.Difference(oldValue, cofly.Clone(oldValue)); change != cofly.Undefined {
+		t.Fatalf("expected Undefined, got %#v", change)
+	}
+
+	change := cofly.Difference(oldValue, newValue)
+
+	if _, err := cofly.MarshalChange(change); err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+
+	output := cofly.Merge(cofly.Clone(oldValue), change, true)
+	if !cofly.Equal(output, newValue) {
+		t.Fatalf("expected %#v, got %#v", newValue, output)
+	}
+
+	t.Run("typed-change", func(t *testing.T) {
+		output := cofly.Merge(map[string]any{"a": 1}, map[string]int{"b": 2}, true)
+		if !cofly.Equal(output, map[string]any{"a": 1, "b": 2}) {
+			t.Fatalf("unexpected output %#v", output)
+		}
+	})
+
+	t.Run("typed-map-target-with-other-values", func(t *testing.T) {
+		output := cofly.Merge(map[string]string{"a": "x"}, map[string]any{"b": 1}, true)
+		if !reflect.DeepEqual(output, map[string]any{"a": "x", "b": 1}) {
+			t.Fatalf("unexpected output %#v", output)
+		}
+	})
+
+	t.Run("splices-into-typed-slice", func(t *testing.T) {
+		output := cofly.Merge([]int{1, 2, 3}, map[string]any{"1..2": []any{5}}, true)
+		if !reflect.DeepEqual(output, []any{1, 5, 3}) {
+			t.Fatalf("unexpected output %#v", output)
+		}
+	})
+
+	if cofly.Hash([]string{"a"}) != cofly.Hash([]any{"a"}) {
+		t.Fatalf("expected equal hashes")
+	}
+}
+
+func TestTypedCollectionsUnsupported(t *testing.T) {
+	if cofly.Equal(map[int]string{1: "a"}, map[int]string{1: "a"}) {
+		t.Fatalf("maps without string keys must not be equal")
+	}
+
+	if _, err := cofly.MarshalChange([]struct{}{{}}); err == nil {
+		t.Fatalf("expected an error for unsupported elements")
+	}
+
+	cyclic := []map[string]any{{}}
+	cyclic[0]["self"] = cyclic
+
+	if err := (cofly.Limits{}).Check(cyclic); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+}
@@ -0,0 +1,383 @@
+package cofly
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotComposable is returned (wrapped) by Compose when no single change is equivalent to the two.
+var ErrNotComposable = errors.New("changes are not composable")
+
+// Compose returns a change equivalent to applying first and then second.
+// Deletions are kept as Undefined markers, and neither change is modified.
+//
+// Changes cannot replace an object with another one, so an object set where the first change
+// deleted or replaced the value returns an error wrapping ErrNotComposable. Invalid sequences
+// (an increment of an array, splices into a deleted value) return an error wrapping ErrInvalidChange.
+func Compose(first any, second any) (any, error) {
+	if first == Undefined {
+		return tryClone(second)
+	}
+
+	if second == Undefined {
+		return tryClone(first)
+	}
+
+	first, err := tryClone(first)
+	if err != nil {
+		return nil, err
+	}
+
+	second, err = tryClone(second)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&merger{isComposing: true}).tryMerge(first, second)
+}
+
+func newNotComposableError(target any) mergeError {
+	if target == Undefined {
+		return mergeError{fmt.Errorf("%w: an object set where the first change deletes the value", ErrNotComposable)}
+	}
+
+	return mergeError{fmt.Errorf("%w: an object set where the first change sets [%T]", ErrNotComposable, target)}
+}
+
+type composedSegmentKind int
+
+const (
+	// composedOriginal is the untouched range [from, to) of the original array.
+	composedOriginal composedSegmentKind = iota
+	// composedModified is the original element at index from, changed by value.
+	composedModified
+	// composedInserted is the new element value.
+	composedInserted
+)
+
+// unboundedIndex marks the original range that runs to the end of the array.
+const unboundedIndex = -1
+
+type composedSegment struct {
+	kind  composedSegmentKind
+	from  int
+	to    int
+	value any
+}
+
+func (s composedSegment) length() int {
+	if s.kind != composedOriginal {
+		return 1
+	}
+
+	if s.to == unboundedIndex {
+		return -1
+	}
+
+	return s.to - s.from
+}
+
+// mergeSplicesIntoSplices composes two splice-maps: targetSplices describes the array
+// after the first change, changeSplices is applied on top of it.
+func (m *merger) mergeSplicesIntoSplices(targetSplices []splice, changeSplices []splice) []splice {
+	sortSplices(targetSplices)
+	validateSplices(targetSplices)
+	sortSplices(changeSplices)
+	validateSplices(changeSplices)
+
+	reader := composedSegmentReader{segments: splicesToSegments(targetSplices)}
+	outputSegments := make([]composedSegment, 0, len(reader.segments)+len(changeSplices))
+	position := 0
+
+	for _, changeSplice := range changeSplices {
+		outputSegments = reader.copy(outputSegments, changeSplice.span.indexFrom-position)
+
+		for elementIndex := range changeSplice.span.length() {
+			segment := reader.next()
+
+			if elementIndex >= len(changeSplice.value) {
+				continue
+			}
+
+			changeValue := changeSplice.value[elementIndex]
+
+			switch segment.kind {
+			case composedOriginal:
+				segment = composedSegment{kind: composedModified, from: segment.from, value: changeValue}
+			case composedInserted:
+				if m.isComposing {
+					segment.value = m.mergeValue(segment.value, changeValue)
+				} else {
+					segment.value = m.merge(segment.value, changeValue)
+				}
+			default:
+				segment.value = m.merge(segment.value, changeValue)
+			}
+
+			outputSegments = append(outputSegments, segment)
+		}
+
+		for _, value := range changeSplice.value[min(changeSplice.span.length(), len(changeSplice.value)):] {
+			outputSegments = append(outputSegments, composedSegment{kind: composedInserted, value: value})
+		}
+
+		position = changeSplice.span.indexTo
+	}
+
+	outputSegments = reader.copy(outputSegments, -1)
+	return segmentsToSplices(outputSegments)
+}
+
+func splicesToSegments(splices []splice) []composedSegment {
+	segments := make([]composedSegment, 0, 2*len(splices)+1)
+	cursor := 0
+
+	for _, splice := range splices {
+		if splice.span.indexFrom > cursor {
+			segments = append(segments, composedSegment{kind: composedOriginal, from: cursor, to: splice.span.indexFrom})
+		}
+
+		for index, value := range splice.value {
+			if index < splice.span.length() {
+				segments = append(segments, composedSegment{kind: composedModified, from: splice.span.indexFrom + index, value: value})
+			} else {
+				segments = append(segments, composedSegment{kind: composedInserted, value: value})
+			}
+		}
+
+		cursor = splice.span.indexTo
+	}
+
+	return append(segments, composedSegment{kind: composedOriginal, from: cursor, to: unboundedIndex})
+}
+
+type composedSegmentReader struct {
+	segments []composedSegment
+	index    int
+	offset   int
+}
+
+// copy appends the next count elements (all remaining ones when count < 0) to output,
+// splitting original ranges where needed.
+func (r *composedSegmentReader) copy(output []composedSegment, count int) []composedSegment {
+	for r.index < len(r.segments) && count != 0 {
+		segment := r.segments[r.index]
+		segment.from += r.offset
+		length := segment.length()
+
+		if count < 0 || (length >= 0 && length <= count) {
+			output = append(output, segment)
+			r.index++
+			r.offset = 0
+			count -= max(length, 0)
+			continue
+		}
+
+		segment.to = segment.from + count
+		output = append(output, segment)
+		r.offset += count
+		count = 0
+	}
+
+	return output
+}
+
+// next returns a single element; original ranges are returned as one-element ranges.
+func (r *composedSegmentReader) next() composedSegment {
+	if r.index >= len(r.segments) {
+		panic("invalid splice-map: span is past the end of the composed array")
+	}
+
+	segment := r.segments[r.index]
+
+	if segment.kind != composedOriginal {
+		r.index++
+		return segment
+	}
+
+	segment.from += r.offset
+	segment.to = segment.from + 1
+	r.offset++
+
+	if r.segments[r.index].to != unboundedIndex && segment.to == r.segments[r.index].to {
+		r.index++
+		r.offset = 0
+	}
+
+	return segment
+}
+
+// segmentsToSplices writes composed segments back as splices over the original array.
+func segmentsToSplices(segments []composedSegment) []splice {
+	var builder spliceBuilder
+	cursor := 0
+
+	for _, segment := range segments {
+		switch segment.kind {
+		case composedOriginal:
+			builder.delete(cursor, segment.from)
+			builder.flush()
+
+			if segment.to == unboundedIndex {
+				return builder.splices
+			}
+
+			cursor = segment.to
+		case composedModified:
+			builder.delete(cursor, segment.from)
+			builder.modify(segment.from, segment.value)
+			cursor = segment.from + 1
+		case composedInserted:
+			builder.insert(cursor, segment.value)
+		}
+	}
+
+	builder.flush()
+	return builder.splices
+}
+
+// spliceBuilder collects edits in array order and joins neighbouring ones into as few
+// splices as possible, without changing what Merge does with them.
+type spliceBuilder struct {
+	splices []splice
+	current splice
+	open    bool
+}
+
+func (b *spliceBuilder) flush() {
+	if b.open {
+		b.splices = append(b.splices, b.current)
+		b.open = false
+	}
+}
+
+func (b *spliceBuilder) start(from, to int, value []any) {
+	b.flush()
+	b.current = splice{span: newSpan(from, to), value: value}
+	b.open = true
+}
+
+// replacedCount is the number of payload elements merged into original elements.
+func (b *spliceBuilder) replacedCount() int {
+	return min(len(b.current.value), b.current.span.length())
+}
+
+func (b *spliceBuilder) modify(index int, value any) {
+	if b.open && b.current.span.indexTo == index && len(b.current.value) == b.current.span.length() {
+		b.current.span.indexTo++
+		b.current.value = append(b.current.value, value)
+		return
+	}
+
+	b.start(index, index+1, []any{value})
+}
+
+func (b *spliceBuilder) delete(from, to int) {
+	for index := from; index < to; index++ {
+		if b.open && b.current.span.indexTo == index &&
+			(len(b.current.value) <= b.current.span.length() || isReplacementValue(b.current.value[b.current.span.length()])) {
+			b.current.span.indexTo++
+			continue
+		}
+
+		b.start(index, index+1, []any{})
+	}
+}
+
+func (b *spliceBuilder) insert(index int, value any) {
+	if b.open && b.current.span.indexTo == index &&
+		(b.replacedCount() == b.current.span.length() || isReplacementValue(value)) {
+		b.current.value = append(b.current.value, value)
+		return
+	}
+
+	b.start(index, index, []any{value})
+}
+
+// isReplacementValue reports whether merging value into any element yields value itself,
+// so it can take the place of a deleted element inside a splice.
+func isReplacementValue(value any) bool {
+	switch value.(type) {
+	case map[string]any, Splices:
+		return false
+	default:
+		return value != Undefined
+	}
+}
+
+// splicesToMap converts composed splices back to a splice-map. Splices that cancel
+// out entirely become an empty insertion, so the result still reads as an array change.
+func splicesToMap(splices []splice) map[string]any {
+	if len(splices) == 0 {
+		return map[string]any{newSpan(0, 0).string(): []any{}}
+	}
+
+	changeMap := make(map[string]any, len(splices))
+
+	for _, splice := range splices {
+		changeMap[splice.span.string()] = splice.value
+	}
+
+	return changeMap
+}
+
+func splicesToSplices(splices []splice) Splices {
+	output := make(Splices, 0, len(splices))
+
+	for _, splice := range splices {
+		output = append(output, Splice{From: splice.span.indexFrom, To: splice.span.indexTo, Values: splice.value})
+	}
+
+	return output
+}
+
+// mergeStringSplicesIntoStringSplices composes two string splice-maps.
+func mergeStringSplicesIntoStringSplices(targetSplices []stringSplice, changeSplices []stringSplice) map[string]any {
+	sortStringSplices(targetSplices)
+	sortStringSplices(changeSplices)
+
+	// String splices behave like array splices of runes, which always replace the rune they land on,
+	// so the array composition can be reused. Runes are numbers, so U+0000 is not taken for Undefined.
+	toSplices := func(stringSplices []stringSplice) []splice {
+		splices := make([]splice, 0, len(stringSplices))
+
+		for _, stringSplice := range stringSplices {
+			runes := []rune(stringSplice.value)
+			value := make([]any, 0, len(runes))
+
+			for _, r := range runes {
+				value = append(value, r)
+			}
+
+			splices = append(splices, splice{span: stringSplice.span, value: value})
+		}
+
+		return splices
+	}
+
+	composed := (&merger{}).mergeSplicesIntoSplices(toSplices(targetSplices), toSplices(changeSplices))
+	if len(composed) == 0 {
+		return map[string]any{newSpan(0, 0).string(): ""}
+	}
+
+	changeMap := make(map[string]any, len(composed))
+
+	for _, splice := range composed {
+		value := make([]rune, 0, len(splice.value))
+
+		for _, element := range splice.value {
+			value = append(value, element.(rune))
+		}
+
+		changeMap[splice.span.string()] = string(value)
+	}
+
+	return changeMap
+}
+
+func sortStringSplices(splices []stringSplice) {
+	slices.SortFunc(splices, func(a, b stringSplice) int {
+		return compareSpans(a.span, b.span)
+	})
+}
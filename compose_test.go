@@ -0,0 +1,237 @@
+package cofly_test
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestCompose(t *testing.T) {
+	t.Run("splices-merge-note-example", func(t *testing.T) {
+		a := []any{"A", "B", "C", "D", "E", "F", "G", "H"}
+		c1 := map[string]any{
+			"1..":  []any{"1", "2"},
+			"4..6": []any{"3"},
+		}
+		c2 := map[string]any{
+			"0..2": []any{},
+			"3..4": []any{"7", "8"},
+			"6..":  []any{"9"},
+		}
+
+		composed := mustCompose(t, c1, c2)
+		want := cofly.Merge(cofly.Merge(cofly.Clone(a), c1, true), c2, true)
+		if got := cofly.Merge(cofly.Clone(a), composed, true); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v (composed=%#v)", want, got, composed)
+		}
+		if want := []any{"2", "7", "8", "C", "D", "9", "3", "G", "H"}; !reflect.DeepEqual(want, cofly.Merge(cofly.Clone(a), composed, true)) {
+			t.Fatalf("unexpected result for composed %#v", composed)
+		}
+	})
+
+	t.Run("does-not-modify-arguments", func(t *testing.T) {
+		first := map[string]any{"a": map[string]any{"x": 1}}
+		second := map[string]any{"a": map[string]any{"y": cofly.Undefined}}
+
+		composed := mustCompose(t, first, second)
+		want := map[string]any{"a": map[string]any{"x": 1, "y": cofly.Undefined}}
+		if !reflect.DeepEqual(composed, want) {
+			t.Fatalf("expected %#v, got %#v", want, composed)
+		}
+		if !reflect.DeepEqual(first, map[string]any{"a": map[string]any{"x": 1}}) {
+			t.Fatalf("first was modified: %#v", first)
+		}
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		if got := mustCompose(t, cofly.Undefined, 1); got != 1 {
+			t.Fatalf("expected 1, got %#v", got)
+		}
+		if got := mustCompose(t, 1, cofly.Undefined); got != 1 {
+			t.Fatalf("expected 1, got %#v", got)
+		}
+	})
+
+	t.Run("element-changes-inside-splices", func(t *testing.T) {
+		a := []any{map[string]any{"v": 1}, map[string]any{"v": 2}, "x"}
+		b := []any{map[string]any{"v": 1, "w": 1}, "new", map[string]any{"v": 2}, "x"}
+		c := []any{map[string]any{"w": 2}, "new", map[string]any{"v": 3}}
+
+		assertComposition(t, a, b, c, cofly.DifferenceOptions{})
+	})
+
+	t.Run("compact-splices", func(t *testing.T) {
+		options := cofly.DifferenceOptions{CompactSplices: true}
+		a := []any{1, 2, 3, 4}
+		b := []any{0, 1, 3, 4, 5}
+		c := []any{0, 3, 6, 5}
+
+		composed := assertComposition(t, a, b, c, options)
+		if _, ok := composed.(cofly.Splices); !ok {
+			t.Fatalf("expected Splices, got %#v", composed)
+		}
+	})
+
+	t.Run("string-splices", func(t *testing.T) {
+		options := cofly.DifferenceOptions{StringSpliceThreshold: 1}
+		a := "the quick brown fox jumps over the lazy dog"
+		b := "the quick red fox jumps over the lazy dog!"
+		c := "a quick red fox leaps over the lazy dog!"
+
+		composed := assertComposition(t, a, b, c, options)
+		if _, ok := composed.(map[string]any); !ok {
+			t.Fatalf("expected string splice-map, got %#v", composed)
+		}
+	})
+
+	t.Run("cancelling-splices", func(t *testing.T) {
+		composed := mustCompose(t, map[string]any{"1..": []any{"x"}}, map[string]any{"1..2": []any{}})
+		if got := cofly.Merge([]any{"a", "b"}, composed, true); !reflect.DeepEqual(got, []any{"a", "b"}) {
+			t.Fatalf("unexpected result %#v for composed %#v", got, composed)
+		}
+
+		composed = mustCompose(t, map[string]any{"1..": "x"}, map[string]any{"1..2": ""})
+		if got := cofly.Merge("ab", composed, true); got != "ab" {
+			t.Fatalf("unexpected result %#v for composed %#v", got, composed)
+		}
+	})
+
+	t.Run("string-splices-with-nul-runes", func(t *testing.T) {
+		first := map[string]any{"0..": "ab"}
+		second := map[string]any{"0..1": "\x00Q"}
+
+		composed := mustCompose(t, first, second)
+		want := cofly.Merge(cofly.Merge("", first, true), second, true)
+		if got := cofly.Merge("", composed, true); got != want {
+			t.Fatalf("expected %q, got %q (composed=%#v)", want, got, composed)
+		}
+	})
+
+	t.Run("increments-and-set-changes", func(t *testing.T) {
+		composed := mustCompose(t, map[string]any{"n": cofly.Increment(2)}, map[string]any{"n": cofly.Increment(3)})
+		if !reflect.DeepEqual(composed, map[string]any{"n": cofly.Increment(5)}) {
+			t.Fatalf("unexpected composed %#v", composed)
+		}
+
+		composed = mustCompose(t, map[string]any{"n": cofly.Undefined}, map[string]any{"n": cofly.Increment(3)})
+		if got := cofly.Merge(map[string]any{"n": 7}, composed, true); !reflect.DeepEqual(got, map[string]any{"n": 3}) {
+			t.Fatalf("unexpected result %#v for composed %#v", got, composed)
+		}
+
+		composed = mustCompose(t,
+			map[string]any{"tags": map[string]any{cofly.SetAddKey: []any{"a"}}},
+			map[string]any{"tags": map[string]any{cofly.SetRemoveKey: []any{"b"}}},
+		)
+		if got := cofly.Merge(map[string]any{"tags": []any{"b", "c"}}, composed, true); !reflect.DeepEqual(got, map[string]any{"tags": []any{"c", "a"}}) {
+			t.Fatalf("unexpected result %#v for composed %#v", got, composed)
+		}
+	})
+
+	t.Run("replaced-arrays-are-values", func(t *testing.T) {
+		first := map[string]any{"list": []any{map[string]any{"x": 1}}}
+		second := map[string]any{"list": map[string]any{"0..1": []any{map[string]any{"x": cofly.Undefined}}}}
+
+		composed := mustCompose(t, first, second)
+		if got := cofly.Merge(map[string]any{"list": []any{}}, composed, true); !reflect.DeepEqual(got, map[string]any{"list": []any{map[string]any{}}}) {
+			t.Fatalf("unexpected result %#v for composed %#v", got, composed)
+		}
+	})
+
+	t.Run("object-recreated-after-delete-is-not-composable", func(t *testing.T) {
+		for _, first := range []any{
+			map[string]any{"a": cofly.Undefined},
+			map[string]any{"a": 5},
+			map[string]any{"a": []any{1}},
+		} {
+			_, err := cofly.Compose(first, map[string]any{"a": map[string]any{"y": 2}})
+			if !errors.Is(err, cofly.ErrNotComposable) {
+				t.Fatalf("expected ErrNotComposable for %#v, got %v", first, err)
+			}
+		}
+	})
+
+	t.Run("invalid-sequence", func(t *testing.T) {
+		_, err := cofly.Compose(map[string]any{"a": "text"}, map[string]any{"a": cofly.Increment(1)})
+		if !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+	})
+
+	t.Run("random-arrays", func(t *testing.T) {
+		random := rand.New(rand.NewSource(7))
+
+		randomArray := func() []any {
+			array := make([]any, random.Intn(8))
+			for i := range array {
+				if random.Intn(4) == 0 {
+					array[i] = map[string]any{"v": random.Intn(3)}
+				} else {
+					array[i] = random.Intn(5)
+				}
+			}
+			return array
+		}
+
+		for range 2000 {
+			assertComposition(t, randomArray(), randomArray(), randomArray(), cofly.DifferenceOptions{})
+		}
+
+		randomObject := func() map[string]any {
+			object := map[string]any{}
+			for _, key := range []string{"a", "b", "c"} {
+				switch random.Intn(3) {
+				case 0:
+					object[key] = randomArray()
+				case 1:
+					object[key] = map[string]any{"list": randomArray()}
+				}
+			}
+			return object
+		}
+
+		for range 2000 {
+			assertComposition(t, randomObject(), randomObject(), randomObject(), cofly.DifferenceOptions{})
+		}
+	})
+}
+
+func assertComposition(t *testing.T, a, b, c any, options cofly.DifferenceOptions) any {
+	t.Helper()
+
+	first := cofly.DifferenceWithOptions(a, b, options)
+	second := cofly.DifferenceWithOptions(b, c, options)
+
+	composed, err := cofly.Compose(first, second)
+	if errors.Is(err, cofly.ErrNotComposable) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v (first=%#v second=%#v)", err, first, second)
+	}
+
+	got := cofly.Clone(a)
+	if composed != cofly.Undefined {
+		got = cofly.Merge(got, cofly.Clone(composed), true)
+	}
+
+	if !cofly.Equal(got, c) {
+		t.Fatalf("composition failed: a=%#v b=%#v c=%#v first=%#v second=%#v composed=%#v got=%#v",
+			a, b, c, first, second, composed, got)
+	}
+
+	return composed
+}
+
+func mustCompose(t *testing.T, first, second any) any {
+	t.Helper()
+
+	composed, err := cofly.Compose(first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return composed
+}
@@ -0,0 +1,69 @@
+package cofly
+
+// Differ lets a type define how its values are compared, diffed and merged.
+// Its values are atomic to the rest of the package: they are not walked into.
+type Differ interface {
+	// CoflyEqual reports whether the value equals other, which can be of any type.
+	CoflyEqual(other any) bool
+	// CoflyDiff returns the change that turns old into the value: an object change, or a replacement.
+	// It is not called for equal values.
+	CoflyDiff(old any) any
+	// CoflyMerge returns the value with an object change (a map[string]any) applied. Other changes replace
+	// the value without calling it, but objects that replace it are passed to it too, and it should return them.
+	CoflyMerge(change any) any
+}
+
+// Cloner is implemented by Differ types whose values are mutable. Other Differ values are shared by Clone.
+type Cloner interface {
+	CoflyClone() any
+}
+
+func asDiffer(value any) (Differ, bool) {
+	switch value.(type) {
+	case nil,
+		bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64,
+		string,
+		map[string]any,
+		[]any,
+		Splices:
+		return nil, false
+	}
+
+	differ, ok := value.(Differ)
+	return differ, ok
+}
+
+// differEqual compares the values with CoflyEqual when one of them is a Differ.
+func differEqual(oldValue, newValue any) (isEqual bool, ok bool) {
+	if differ, ok := asDiffer(newValue); ok {
+		return differ.CoflyEqual(oldValue), true
+	}
+
+	if differ, ok := asDiffer(oldValue); ok {
+		return differ.CoflyEqual(newValue), true
+	}
+
+	return false, false
+}
+
+// differDifference diffs the values with CoflyDiff when one of them is a Differ.
+// A Differ replaced by another value is replaced as a whole, which Merge does for every change but an object.
+func differDifference(oldValue, newValue any) (change any, ok bool) {
+	isEqual, ok := differEqual(oldValue, newValue)
+	if !ok {
+		return nil, false
+	}
+
+	if isEqual {
+		return Undefined, true
+	}
+
+	if differ, ok := asDiffer(newValue); ok {
+		return differ.CoflyDiff(oldValue), true
+	}
+
+	return newValue, true
+}
@@ -0,0 +1,154 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+// counter is diffed as increments instead of replacements.
+type counter struct {
+	value int
+}
+
+func (c counter) CoflyEqual(other any) bool {
+	otherCounter, ok := other.(counter)
+	return ok && otherCounter.value == c.value
+}
+
+func (c counter) CoflyDiff(old any) any {
+	if old, ok := old.(counter); ok {
+		return map[string]any{"add": c.value - old.value}
+	}
+
+	return c
+}
+
+func (c counter) CoflyMerge(change any) any {
+	add, ok := change.(map[string]any)["add"]
+	if !ok {
+		// An object that replaces the counter.
+		return change
+	}
+
+	return counter{value: c.value + add.(int)}
+}
+
+// register is a mutable Differ.
+type register struct {
+	values []int
+}
+
+func (r *register) CoflyEqual(other any) bool {
+	otherRegister, ok := other.(*register)
+	return ok && reflect.DeepEqual(otherRegister.values, r.values)
+}
+
+func (r *register) CoflyDiff(old any) any {
+	return r
+}
+
+func (r *register) CoflyMerge(change any) any {
+	return change
+}
+
+func (r *register) CoflyClone() any {
+	return &register{values: append([]int(nil), r.values...)}
+}
+
+func TestDiffer(t *testing.T) {
+	oldValue := map[string]any{"hits": counter{value: 1}, "name": "a"}
+	newValue := map[string]any{"hits": counter{value: 4}, "name": "a"}
+
+	t.Run("equal", func(t *testing.T) {
+		if !cofly.Equal(oldValue, cofly.Clone(oldValue)) {
+			t.Fatalf("expected equal")
+		}
+
+		if cofly.Equal(oldValue, newValue) {
+			t.Fatalf("expected not equal")
+		}
+
+		if cofly.Equal(counter{value: 1}, 1) || cofly.Equal(1, counter{value: 1}) {
+			t.Fatalf("expected a counter not to equal a number")
+		}
+	})
+
+	t.Run("difference-and-merge", func(t *testing.T) {
+		change := cofly.Difference(oldValue, newValue)
+
+		expected := map[string]any{"hits": map[string]any{"add": 3}}
+		if !reflect.DeepEqual(change, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, change)
+		}
+
+		output := cofly.Merge(cofly.Clone(oldValue), change, true)
+		if !reflect.DeepEqual(output, newValue) {
+			t.Fatalf("expected %#v, got %#v", newValue, output)
+		}
+
+		if change := cofly.Difference(oldValue, cofly.Clone(oldValue)); change != cofly.Undefined {
+			t.Fatalf("expected Undefined, got %#v", change)
+		}
+	})
+
+	t.Run("replacement", func(t *testing.T) {
+		if change := cofly.Difference(1, counter{value: 2}); change != (counter{value: 2}) {
+			t.Fatalf("expected the counter, got %#v", change)
+		}
+
+		if change := cofly.Difference(counter{value: 2}, "none"); change != "none" {
+			t.Fatalf("expected the string, got %#v", change)
+		}
+
+		if output := cofly.Merge(1, counter{value: 2}, true); output != (counter{value: 2}) {
+			t.Fatalf("expected the counter, got %#v", output)
+		}
+
+		if output := cofly.Merge(counter{value: 2}, cofly.Undefined, true); output != (counter{value: 2}) {
+			t.Fatalf("expected Undefined to keep the counter, got %#v", output)
+		}
+	})
+
+	t.Run("replacement-and-deletion-round-trip", func(t *testing.T) {
+		for _, value := range []any{"none", 5, nil, true, []any{1}, map[string]any{"x": 1}, &register{values: []int{1}}} {
+			newValue := map[string]any{"hits": value, "name": "a"}
+
+			change := cofly.Difference(oldValue, newValue)
+			if output := cofly.Merge(cofly.Clone(oldValue), change, true); !reflect.DeepEqual(output, newValue) {
+				t.Fatalf("expected %#v, got %#v (change=%#v)", newValue, output, change)
+			}
+		}
+
+		newValue := map[string]any{"name": "a"}
+
+		change := cofly.Difference(oldValue, newValue)
+		if output := cofly.Merge(cofly.Clone(oldValue), change, true); !reflect.DeepEqual(output, newValue) {
+			t.Fatalf("expected %#v, got %#v (change=%#v)", newValue, output, change)
+		}
+	})
+
+	t.Run("invalid-change", func(t *testing.T) {
+		var target any = map[string]any{"hits": counter{value: 1}}
+
+		err := cofly.ApplyAll(&target, []any{map[string]any{"hits": map[string]any{"add": "x"}}}, true)
+		if !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		source := &register{values: []int{1}}
+
+		cloned := cofly.Clone(map[string]any{"r": source}).(map[string]any)["r"].(*register)
+		if cloned == source || !cloned.CoflyEqual(source) {
+			t.Fatalf("expected an equal copy, got %#v", cloned)
+		}
+
+		if cloned := cofly.Clone(counter{value: 1}); cloned != (counter{value: 1}) {
+			t.Fatalf("expected the counter, got %#v", cloned)
+		}
+	})
+}
@@ -2,9 +2,61 @@ package cofly
 
 import (
 	"fmt"
+	"strconv"
 )
 
+type DifferenceOptions struct {
+	// CompactSplices makes array changes come out as Splices instead of splice-maps.
+	CompactSplices bool
+
+	// Increments makes numeric changes come out as increments ({"$inc": delta}).
+	Increments bool
+
+	// StringSpliceThreshold enables string splice-maps for strings of at least this many bytes
+	// (old or new). Zero disables them.
+	StringSpliceThreshold int
+
+	// UnorderedPaths lists JSON Pointer patterns of arrays that are sets ("*" matches any
+	// single segment). Their changes come out as set operations ({"$add": [...], "$remove": [...]}).
+	UnorderedPaths []string
+
+	unorderedPatterns [][]string
+}
+
 func Difference(oldValue any, newValue any) any {
+	return DifferenceWithOptions(oldValue, newValue, DifferenceOptions{})
+}
+
+func DifferenceWithOptions(oldValue any, newValue any, options DifferenceOptions) any {
+	options.parseUnorderedPaths()
+
+	return options.difference(oldValue, newValue, nil)
+}
+
+func (options *DifferenceOptions) parseUnorderedPaths() {
+	options.unorderedPatterns = make([][]string, 0, len(options.UnorderedPaths))
+
+	for _, unorderedPath := range options.UnorderedPaths {
+		pattern, err := parsePath(unorderedPath)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		options.unorderedPatterns = append(options.unorderedPatterns, pattern)
+	}
+}
+
+func (options *DifferenceOptions) difference(oldValue any, newValue any, path []string) any {
+	if change, ok := differDifference(oldValue, newValue); ok {
+		return change
+	}
+
+	oldValue, newValue = normalize(oldValue), normalize(newValue)
+
+	if isLeaf(oldValue) || isLeaf(newValue) {
+		return leafDifference(oldValue, newValue)
+	}
+
 	switch newValue := newValue.(type) {
 	case nil:
 		switch oldValue.(type) {
@@ -49,7 +101,7 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
-			return newValue
+			return options.numberDifference(oldValue, newValue)
 		case
 			uint, uint8, uint16, uint32, uint64,
 			float32, float64:
@@ -57,7 +109,7 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
-			return newValue
+			return options.numberDifference(oldValue, newValue)
 		case
 			nil,
 			bool,
@@ -75,7 +127,7 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
-			return newValue
+			return options.numberDifference(oldValue, newValue)
 		case
 			int, int8, int16, int32, int64,
 			float32, float64:
@@ -83,7 +135,7 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
-			return newValue
+			return options.numberDifference(oldValue, newValue)
 		case
 			nil,
 			bool,
@@ -104,7 +156,7 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
-			return newValue
+			return options.numberDifference(oldValue, newValue)
 		case
 			nil,
 			bool,
@@ -122,6 +174,12 @@ func Difference(oldValue any, newValue any) any {
 				return Undefined
 			}
 
+			if options.StringSpliceThreshold > 0 &&
+				max(len(oldValue), len(newValue)) >= options.StringSpliceThreshold &&
+				newValue != Undefined {
+				return options.stringDifference(oldValue, newValue)
+			}
+
 			return newValue
 		case
 			nil,
@@ -138,7 +196,7 @@ func Difference(oldValue any, newValue any) any {
 	case map[string]any:
 		switch oldValue := oldValue.(type) {
 		case map[string]any:
-			return mapDifference(oldValue, newValue)
+			return options.mapDifference(oldValue, newValue, path)
 		case
 			nil,
 			bool,
@@ -154,7 +212,11 @@ func Difference(oldValue any, newValue any) any {
 	case []any:
 		switch oldValue := oldValue.(type) {
 		case []any:
-			return arrayDifference(oldValue, newValue)
+			if options.isUnordered(path) {
+				return setDifference(oldValue, newValue)
+			}
+
+			return options.arrayDifference(oldValue, newValue, path)
 		case
 			nil,
 			bool,
@@ -172,8 +234,27 @@ func Difference(oldValue any, newValue any) any {
 	}
 }
 
+// childPath extends path only when some option depends on it.
+func (options *DifferenceOptions) childPath(path []string, segment string) []string {
+	if len(options.unorderedPatterns) == 0 {
+		return nil
+	}
+
+	return append(path[:len(path):len(path)], segment)
+}
+
+func (options *DifferenceOptions) isUnordered(path []string) bool {
+	for _, pattern := range options.unorderedPatterns {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // mapDifference is a helper function that calculates the difference between two maps
-func mapDifference(oldMap, newMap map[string]any) any {
+func (options *DifferenceOptions) mapDifference(oldMap, newMap map[string]any, path []string) any {
 	keys := make(map[string]struct{})
 
 	for oldKey := range oldMap {
@@ -191,7 +272,7 @@ func mapDifference(oldMap, newMap map[string]any) any {
 		newValue, doesNewKeyExist := newMap[key]
 
 		if doesOldKeyExist && doesNewKeyExist {
-			change := Difference(oldValue, newValue)
+			change := options.difference(oldValue, newValue, options.childPath(path, key))
 
 			if change != Undefined {
 				changes[key] = change
@@ -212,15 +293,7 @@ func mapDifference(oldMap, newMap map[string]any) any {
 	return changes
 }
 
-func arrayDifference(oldArray, newArray []any) any {
-	type operation int
-
-	const (
-		skip operation = iota
-		insert
-		delete
-	)
-
+func (options *DifferenceOptions) arrayDifference(oldArray, newArray []any, path []string) any {
 	n, m := len(oldArray), len(newArray)
 	max := n + m
 
@@ -230,12 +303,20 @@ func arrayDifference(oldArray, newArray []any) any {
 
 	// Fast paths (keep exact output contract).
 	if n == 0 {
+		if options.CompactSplices {
+			return Splices{{From: 0, To: 0, Values: newArray}}
+		}
+
 		changes := make(map[string]any, 1)
 		changes[newSpan(0, 0).string()] = newArray
 		return changes
 	}
 
 	if m == 0 {
+		if options.CompactSplices {
+			return Splices{{From: 0, To: n, Values: make([]any, 0)}}
+		}
+
 		changes := make(map[string]any, 1)
 		changes[newSpan(0, n).string()] = make([]any, 0)
 		return changes
@@ -255,6 +336,132 @@ func arrayDifference(oldArray, newArray []any) any {
 		}
 	}
 
+	// Equal values have equal hashes, so different hashes rule out deep comparisons.
+	oldHashes, newHashes := elementHashes(oldArray), elementHashes(newArray)
+	compareHashes := oldHashes != nil && newHashes != nil
+
+	operations := myers(n, m, func(x, y int) bool {
+		if compareHashes && oldHashes[x] != newHashes[y] {
+			return false
+		}
+
+		return Equal(oldArray[x], newArray[y])
+	})
+
+	changes := make(map[string]any)
+	var compactChanges Splices
+	oldI, newI := 0, 0
+	open := false
+	curFrom, curTo := 0, 0
+	curValue := make([]any, 0)
+
+	flush := func() {
+		if !open {
+			return
+		}
+
+		// For replacements (delete+insert in the same splice), store element-level diffs
+		// instead of full new values. This makes the resulting patch "speak" the same
+		// language as Merge(): it will Merge(oldElem, diffElem) to reach newElem.
+		//
+		// For i in [0..rep), we are replacing oldArray[curFrom+i] with curValue[i].
+		// For i >= rep, curValue is a pure insertion payload.
+		delLen := curTo - curFrom
+		replacementsCount := min(delLen, len(curValue))
+
+		for i := range replacementsCount {
+			change := options.difference(
+				oldArray[curFrom+i],
+				curValue[i],
+				options.childPath(path, strconv.Itoa(curFrom+i)),
+			)
+
+			if change == Undefined {
+				// Should be rare (Myers should align equal elements), but never emit the
+				// Undefined marker as a change value, because Merge() treats it specially.
+				curValue[i] = oldArray[curFrom+i]
+			} else {
+				curValue[i] = change
+			}
+		}
+
+		if options.CompactSplices {
+			compactChanges = append(compactChanges, Splice{From: curFrom, To: curTo, Values: curValue})
+		} else {
+			span := span{indexFrom: curFrom, indexTo: curTo}
+			changes[span.string()] = curValue
+		}
+
+		open = false
+		curValue = make([]any, 0)
+	}
+
+	for _, operation := range operations {
+		switch operation {
+		case operationSkip:
+			flush()
+			oldI++
+			newI++
+		case operationDelete:
+			if !open {
+				open = true
+				curFrom = oldI
+				curTo = oldI
+				curValue = make([]any, 0)
+			}
+
+			curTo++
+			oldI++
+		case operationInsert:
+			if !open {
+				open = true
+				curFrom = oldI
+				curTo = oldI
+				curValue = make([]any, 0)
+			}
+			curValue = append(curValue, newArray[newI])
+			newI++
+		}
+	}
+
+	flush()
+
+	if options.CompactSplices {
+		if len(compactChanges) == 0 {
+			return Undefined
+		}
+
+		return compactChanges
+	}
+
+	if len(changes) == 0 {
+		return Undefined
+	}
+
+	return changes
+}
+
+type operation int
+
+const (
+	operationSkip operation = iota
+	operationInsert
+	operationDelete
+)
+
+// myers returns the shortest edit script (Myers, 1986) turning a sequence of length n
+// into a sequence of length m, where equal(x, y) compares old element x with new element y.
+func myers(n, m int, equal func(x, y int) bool) []operation {
+	operations, _ := boundedMyers(n, m, n+m, equal)
+	return operations
+}
+
+// boundedMyers is myers that gives up when the script needs more than maxD insertions and deletions.
+// Its trace takes O(maxD²) memory.
+func boundedMyers(n, m, maxD int, equal func(x, y int) bool) ([]operation, bool) {
+	max := n + m
+	maxD = min(maxD, max)
+
 	offset := max
 	v := make([]int, 2*max+1)
 
@@ -263,11 +470,11 @@ func arrayDifference(oldArray, newArray []any) any {
 	}
 
 	v[offset+1] = 0
-	trace := make([][]int, 0, max+1)
+	trace := make([][]int, 0, maxD+1)
 
 	// Reduce GC pressure by storing all trace rows in one buffer when reasonably sized.
 	// For max <= 2000 (your stated upper bound per array is ~1000), this is ~2M ints.
-	totalTraceInts := int64(max+1) * int64(max+2) / 2
+	totalTraceInts := int64(maxD+1) * int64(maxD+2) / 2
 	useTraceArena := totalTraceInts > 0 && totalTraceInts <= 4_000_000
 	var traceArena []int
 	if useTraceArena {
@@ -293,7 +500,7 @@ func arrayDifference(oldArray, newArray []any) any {
 		trace = append(trace, row)
 	}
 
-	for d := 0; d <= max; d++ {
+	for d := 0; d <= maxD; d++ {
 		for k := -d; k <= d; k += 2 {
 			kIndex := offset + k
 			var x int
@@ -308,7 +515,7 @@ func arrayDifference(oldArray, newArray []any) any {
 
 			y := x - k
 
-			for x < n && y < m && Equal(oldArray[x], newArray[y]) {
+			for x < n && y < m && equal(x, y) {
 				x++
 				y++
 			}
@@ -325,6 +532,8 @@ func arrayDifference(oldArray, newArray []any) any {
 		appendTrace(d)
 	}
 
+	return nil, false
+
 BACKTRACK:
 	getTrace := func(row []int, k int) int {
 		// For a given d, trace row stores x values for k in [-d..d] with step=2.
@@ -350,23 +559,23 @@ BACKTRACK:
 		prevY := prevX - prevK
 
 		for x > prevX && y > prevY {
-			operations = append(operations, skip)
+			operations = append(operations, operationSkip)
 			x--
 			y--
 		}
 
 		if x == prevX {
-			operations = append(operations, insert)
+			operations = append(operations, operationInsert)
 			y--
 		} else {
-			operations = append(operations, delete)
+			operations = append(operations, operationDelete)
 			x--
 		}
 	}
 
 	// tail of the snake at d=0
 	for x > 0 && y > 0 {
-		operations = append(operations, skip)
+		operations = append(operations, operationSkip)
 		x--
 		y--
 	}
@@ -376,79 +585,7 @@ BACKTRACK:
 		operations[i], operations[j] = operations[j], operations[i]
 	}
 
-	changes := make(map[string]any)
-	oldI, newI := 0, 0
-	open := false
-	curFrom, curTo := 0, 0
-	curValue := make([]any, 0)
-
-	flush := func() {
-		if !open {
-			return
-		}
-
-		// For replacements (delete+insert in the same splice), store element-level diffs
-		// instead of full new values. This makes the resulting patch "speak" the same
-		// language as Merge(): it will Merge(oldElem, diffElem) to reach newElem.
-		//
-		// For i in [0..rep), we are replacing oldArray[curFrom+i] with curValue[i].
-		// For i >= rep, curValue is a pure insertion payload.
-		delLen := curTo - curFrom
-		replacementsCount := min(delLen, len(curValue))
-
-		for i := range replacementsCount {
-			change := Difference(oldArray[curFrom+i], curValue[i])
-
-			if change == Undefined {
-				// Should be rare (Myers should align equal elements), but never emit the
-				// Undefined marker as a change value, because Merge() treats it specially.
-				curValue[i] = oldArray[curFrom+i]
-			} else {
-				curValue[i] = change
-			}
-		}
-
-		span := span{indexFrom: curFrom, indexTo: curTo}
-		changes[span.string()] = curValue
-		open = false
-		curValue = make([]any, 0)
-	}
-
-	for _, operation := range operations {
-		switch operation {
-		case skip:
-			flush()
-			oldI++
-			newI++
-		case delete:
-			if !open {
-				open = true
-				curFrom = oldI
-				curTo = oldI
-				curValue = make([]any, 0)
-			}
-
-			curTo++
-			oldI++
-		case insert:
-			if !open {
-				open = true
-				curFrom = oldI
-				curTo = oldI
-				curValue = make([]any, 0)
-			}
-			curValue = append(curValue, newArray[newI])
-			newI++
-		}
-	}
-
-	flush()
-
-	if len(changes) == 0 {
-		return Undefined
-	}
-
-	return changes
+	return operations, true
 }
 
 // func arrayDifference__OLD(oldArray, newArray []any, offset int) any {
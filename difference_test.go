@@ -519,3 +519,66 @@ func TestDifference(t *testing.T) {
 		}
 	})
 }
+
+func TestDifferenceWithOptions(t *testing.T) {
+	t.Run("compact-splices-match-splice-maps", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			old  any
+			new  any
+		}{
+			{"replace-and-append", []any{"a", "b", "c"}, []any{"a", "B", "c", "d"}},
+			{"from-empty", []any{}, []any{1, 2}},
+			{"to-empty", []any{1, 2}, []any{}},
+			{"nested", map[string]any{"list": []any{1, []any{2, 3}}}, map[string]any{"list": []any{1, []any{3}, 4}}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				compact := cofly.DifferenceWithOptions(tc.old, tc.new, cofly.DifferenceOptions{CompactSplices: true})
+
+				got := cofly.Merge(cofly.Clone(tc.old), compact, true)
+				if !cofly.Equal(got, tc.new) {
+					t.Fatalf("expected %#v, got %#v", tc.new, got)
+				}
+
+				gotJSON, err := cofly.MarshalChange(compact)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				wantJSON, err := cofly.MarshalChange(cofly.Difference(tc.old, tc.new))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(gotJSON) != string(wantJSON) {
+					t.Fatalf("expected %s, got %s", wantJSON, gotJSON)
+				}
+			})
+		}
+	})
+
+	t.Run("compact-splices-shape", func(t *testing.T) {
+		got := cofly.DifferenceWithOptions(
+			[]any{"a", "b", "c"},
+			[]any{"a", "B", "c", "d"},
+			cofly.DifferenceOptions{CompactSplices: true},
+		)
+		want := cofly.Splices{
+			{From: 1, To: 2, Values: []any{"B"}},
+			{From: 3, To: 3, Values: []any{"d"}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+		if m := want.Map(); !reflect.DeepEqual(m, map[string]any{"1..2": []any{"B"}, "3..": []any{"d"}}) {
+			t.Fatalf("unexpected map: %#v", m)
+		}
+	})
+
+	t.Run("compact-splices-unchanged-is-undefined", func(t *testing.T) {
+		got := cofly.DifferenceWithOptions([]any{1, 2}, []any{1.0, 2}, cofly.DifferenceOptions{CompactSplices: true})
+		if got != cofly.Undefined {
+			t.Fatalf("expected Undefined, got %#v", got)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package cofly
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrVersionNotFound  = errors.New("version not found")
+	ErrVersionCompacted = errors.New("version compacted")
+)
+
+// VersionedChange is a log entry: Change turns the value at PreviousVersion into the value at Version.
+// Entries produced by Compact span several versions.
+type VersionedChange struct {
+	PreviousVersion uint64
+	Version         uint64
+	Change          any
+}
+
+// Document is a value with a log of the changes applied to it.
+// It is not safe for concurrent use.
+type Document struct {
+	base        any
+	baseVersion uint64
+	value       any
+	changes     []VersionedChange
+}
+
+func NewDocument(value any) *Document {
+	return &Document{
+		base:  Clone(value),
+		value: Clone(value),
+	}
+}
+
+func (d *Document) Version() uint64 {
+	if len(d.changes) == 0 {
+		return d.baseVersion
+	}
+
+	return d.changes[len(d.changes)-1].Version
+}
+
+// Value returns a copy of the current value.
+func (d *Document) Value() any {
+	return Clone(d.value)
+}
+
+// Apply merges the change into the document and returns the new version.
+// An invalid change leaves the document untouched; Undefined is a no-op.
+func (d *Document) Apply(change any) (uint64, error) {
+	if change == Undefined {
+		return d.Version(), nil
+	}
+
+	change, err := tryClone(change)
+	if err != nil {
+		return d.Version(), err
+	}
+
+	value, err := tryMerge(Clone(d.value), Clone(change), true)
+	if err != nil {
+		return d.Version(), err
+	}
+
+	version := d.Version()
+
+	d.value = value
+	d.changes = append(d.changes, VersionedChange{
+		PreviousVersion: version,
+		Version:         version + 1,
+		Change:          change,
+	})
+
+	return version + 1, nil
+}
+
+// Snapshot returns the value at the given version.
+func (d *Document) Snapshot(version uint64) (any, error) {
+	if version > d.Version() {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+
+	index, err := d.indexAfter(version)
+	if err != nil {
+		return nil, err
+	}
+
+	if index == len(d.changes) {
+		return d.Value(), nil
+	}
+
+	value := Clone(d.base)
+
+	for _, change := range d.changes[:index] {
+		value = Merge(value, Clone(change.Change), true)
+	}
+
+	return value, nil
+}
+
+// ChangesSince returns copies of the log entries that follow the given version.
+func (d *Document) ChangesSince(version uint64) ([]VersionedChange, error) {
+	if version > d.Version() {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+
+	index, err := d.indexAfter(version)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]VersionedChange, 0, len(d.changes)-index)
+
+	for _, change := range d.changes[index:] {
+		change.Change = Clone(change.Change)
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// Compact composes every log entry up to the given version into a single entry.
+// Versions inside the compacted range can no longer be read with Snapshot or ChangesSince.
+func (d *Document) Compact(version uint64) error {
+	if version > d.Version() {
+		return fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+
+	index, err := d.indexAfter(version)
+	if err != nil {
+		return err
+	}
+
+	if index <= 1 {
+		return nil
+	}
+
+	newValue, err := d.Snapshot(version)
+	if err != nil {
+		return err
+	}
+
+	var change any = Undefined
+
+	for _, entry := range d.changes[:index] {
+		if change, err = Compose(change, entry.Change); err != nil {
+			break
+		}
+	}
+
+	// Composition cannot express every sequence (see Compose), so fall back to a difference.
+	if err != nil || !Equal(Merge(Clone(d.base), Clone(change), true), newValue) {
+		change = Difference(d.base, newValue)
+	}
+
+	d.changes = append([]VersionedChange{{
+		PreviousVersion: d.baseVersion,
+		Version:         version,
+		Change:          change,
+	}}, d.changes[index:]...)
+
+	return nil
+}
+
+// Truncate drops the log entries up to the given version, which becomes the oldest readable version.
+func (d *Document) Truncate(version uint64) error {
+	base, err := d.Snapshot(version)
+	if err != nil {
+		return err
+	}
+
+	d.base = base
+	d.baseVersion = version
+	index, _ := d.indexAfter(version)
+	d.changes = append([]VersionedChange(nil), d.changes[index:]...)
+
+	return nil
+}
+
+// indexAfter returns the index of the first log entry that ends after the given version.
+// The version must not fall inside a compacted entry.
+func (d *Document) indexAfter(version uint64) (int, error) {
+	if version < d.baseVersion {
+		return 0, fmt.Errorf("%w: %d", ErrVersionCompacted, version)
+	}
+
+	for index, change := range d.changes {
+		if change.Version > version {
+			if change.PreviousVersion < version {
+				return 0, fmt.Errorf("%w: %d", ErrVersionCompacted, version)
+			}
+
+			return index, nil
+		}
+	}
+
+	return len(d.changes), nil
+}
@@ -0,0 +1,185 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestDocument(t *testing.T) {
+	newDocument := func(t *testing.T) (*cofly.Document, []any) {
+		t.Helper()
+
+		values := []any{
+			map[string]any{"title": "draft", "tags": []any{"a"}},
+			map[string]any{"title": "draft", "tags": []any{"a", "b"}},
+			map[string]any{"title": "final", "tags": []any{"b"}},
+			map[string]any{"tags": []any{"b"}, "views": 1},
+			map[string]any{"tags": []any{"b", "c"}, "views": 2},
+		}
+
+		document := cofly.NewDocument(values[0])
+		for i := 1; i < len(values); i++ {
+			version, err := document.Apply(cofly.Difference(values[i-1], values[i]))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != uint64(i) {
+				t.Fatalf("expected version %d, got %d", i, version)
+			}
+		}
+
+		return document, values
+	}
+
+	t.Run("snapshots", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		for version, want := range values {
+			got, err := document.Snapshot(uint64(version))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("version %d: expected %#v, got %#v", version, want, got)
+			}
+		}
+
+		if _, err := document.Snapshot(5); !errors.Is(err, cofly.ErrVersionNotFound) {
+			t.Fatalf("expected ErrVersionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("value-is-a-copy", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		document.Value().(map[string]any)["views"] = 100
+		if got := document.Value(); !reflect.DeepEqual(got, values[4]) {
+			t.Fatalf("expected %#v, got %#v", values[4], got)
+		}
+	})
+
+	t.Run("changes-since", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		changes, err := document.ChangesSince(2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(changes) != 2 || changes[0].PreviousVersion != 2 || changes[1].Version != 4 {
+			t.Fatalf("unexpected changes %#v", changes)
+		}
+
+		value := cofly.Clone(values[2])
+		for _, change := range changes {
+			value = cofly.Merge(value, change.Change, true)
+		}
+		if !reflect.DeepEqual(value, values[4]) {
+			t.Fatalf("expected %#v, got %#v", values[4], value)
+		}
+
+		if changes, err := document.ChangesSince(4); err != nil || len(changes) != 0 {
+			t.Fatalf("expected no changes, got %#v, %v", changes, err)
+		}
+	})
+
+	t.Run("invalid-change-is-rejected", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		_, err := document.Apply(map[string]any{"tags": map[string]any{"7..": []any{"x"}}, "views": 3})
+		if !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+		if document.Version() != 4 || !reflect.DeepEqual(document.Value(), values[4]) {
+			t.Fatalf("document changed: version %d, value %#v", document.Version(), document.Value())
+		}
+	})
+
+	t.Run("undefined-is-a-no-op", func(t *testing.T) {
+		document, _ := newDocument(t)
+
+		if version, err := document.Apply(cofly.Undefined); err != nil || version != 4 {
+			t.Fatalf("expected version 4, got %d, %v", version, err)
+		}
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		if err := document.Compact(3); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, version := range []uint64{0, 3, 4} {
+			got, err := document.Snapshot(version)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, values[version]) {
+				t.Fatalf("version %d: expected %#v, got %#v", version, values[version], got)
+			}
+		}
+
+		if _, err := document.Snapshot(2); !errors.Is(err, cofly.ErrVersionCompacted) {
+			t.Fatalf("expected ErrVersionCompacted, got %v", err)
+		}
+		if _, err := document.ChangesSince(1); !errors.Is(err, cofly.ErrVersionCompacted) {
+			t.Fatalf("expected ErrVersionCompacted, got %v", err)
+		}
+
+		changes, err := document.ChangesSince(0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(changes) != 2 || changes[0].PreviousVersion != 0 || changes[0].Version != 3 {
+			t.Fatalf("unexpected changes %#v", changes)
+		}
+	})
+
+	t.Run("compact-delete-and-recreate", func(t *testing.T) {
+		document := cofly.NewDocument(map[string]any{"a": map[string]any{"x": 1}})
+
+		for _, change := range []any{
+			map[string]any{"a": cofly.Undefined},
+			map[string]any{"a": map[string]any{"y": 2}},
+		} {
+			if _, err := document.Apply(change); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if err := document.Compact(2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := document.Snapshot(2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := map[string]any{"a": map[string]any{"y": 2}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		document, values := newDocument(t)
+
+		if err := document.Truncate(2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := document.Snapshot(1); !errors.Is(err, cofly.ErrVersionCompacted) {
+			t.Fatalf("expected ErrVersionCompacted, got %v", err)
+		}
+
+		got, err := document.Snapshot(3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, values[3]) {
+			t.Fatalf("expected %#v, got %#v", values[3], got)
+		}
+	})
+}
@@ -1,6 +1,12 @@
 package cofly
 
 func Equal(oldValue, newValue any) bool {
+	if isEqual, ok := differEqual(oldValue, newValue); ok {
+		return isEqual
+	}
+
+	oldValue, newValue = normalize(oldValue), normalize(newValue)
+
 	switch newValue := newValue.(type) {
 	case nil:
 		return oldValue == nil
@@ -49,7 +55,7 @@ func Equal(oldValue, newValue any) bool {
 		oldValue, ok := oldValue.([]any)
 		return ok && areArraysEqual(oldValue, newValue)
 	default:
-		return false
+		return areLeavesEqual(oldValue, newValue)
 	}
 }
 
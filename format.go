@@ -0,0 +1,238 @@
+package cofly
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type FormatStyle int
+
+const (
+	// FormatText renders plain text.
+	FormatText FormatStyle = iota
+	// FormatColor renders text with ANSI colors for terminals.
+	FormatColor
+	// FormatHTML renders a <pre> element whose lines are <span>s with the classes
+	// cofly-added, cofly-removed, cofly-changed and cofly-invalid.
+	FormatHTML
+)
+
+const (
+	formatAdded   = '+'
+	formatRemoved = '-'
+	formatChanged = '~'
+	formatInvalid = '!'
+)
+
+type formatLine struct {
+	marker byte
+	depth  int
+	text   string
+}
+
+// Format renders the change against its base as an indented tree: "+" for added values,
+// "-" for removed ones and "~" for changed ones, with old and new values and the array
+// positions splices resolve to ("[old→new]" when they differ).
+func Format(base, change any, style FormatStyle) string {
+	var lines []formatLine
+
+	if _, err := tryMerge(Clone(base), Clone(change), true); err != nil {
+		lines = append(lines, formatLine{marker: formatInvalid, text: err.Error()})
+	} else {
+		lines = formatChange(lines, base, change, "", 0)
+	}
+
+	var builder strings.Builder
+
+	if style == FormatHTML {
+		builder.WriteString("<pre class=\"cofly-diff\">\n")
+	}
+
+	for _, line := range lines {
+		text := strings.Repeat("  ", line.depth) + string(line.marker) + " " + line.text
+
+		switch style {
+		case FormatColor:
+			builder.WriteString(formatColors[line.marker] + text + "\x1b[0m\n")
+		case FormatHTML:
+			fmt.Fprintf(&builder, "<span class=\"%s\">%s</span>\n", formatClasses[line.marker], html.EscapeString(text))
+		default:
+			builder.WriteString(text + "\n")
+		}
+	}
+
+	if style == FormatHTML {
+		builder.WriteString("</pre>\n")
+	}
+
+	return builder.String()
+}
+
+var formatColors = map[byte]string{
+	formatAdded:   "\x1b[32m",
+	formatRemoved: "\x1b[31m",
+	formatChanged: "\x1b[33m",
+	formatInvalid: "\x1b[1;31m",
+}
+
+var formatClasses = map[byte]string{
+	formatAdded:   "cofly-added",
+	formatRemoved: "cofly-removed",
+	formatChanged: "cofly-changed",
+	formatInvalid: "cofly-invalid",
+}
+
+// formatChange appends the lines of a change to the old value. label is the key or the array
+// position of the value ("" for the root).
+func formatChange(lines []formatLine, oldValue, change any, label string, depth int) []formatLine {
+	if change == Undefined {
+		return lines
+	}
+
+	// Containers get a header line and their children one level deeper.
+	header := func() {
+		if label != "" {
+			lines = append(lines, formatLine{marker: formatChanged, depth: depth, text: label + ":"})
+			depth++
+		}
+	}
+
+	oldArray, isOldArray := oldValue.([]any)
+	oldMap, isOldMap := oldValue.(map[string]any)
+	changeMap, isChangeMap := change.(map[string]any)
+
+	if isOldArray {
+		if setChange, ok := parseSetChange(changeMap); isChangeMap && ok {
+			header()
+
+			for _, value := range setChange.remove {
+				lines = append(lines, formatLine{marker: formatRemoved, depth: depth, text: formatValue(value)})
+			}
+
+			for _, value := range setChange.add {
+				lines = append(lines, formatLine{marker: formatAdded, depth: depth, text: formatValue(value)})
+			}
+
+			return lines
+		}
+
+		var splices []splice
+		switch change := change.(type) {
+		case Splices:
+			splices = change.parse()
+		case map[string]any:
+			splices = parseSplices(change)
+		}
+
+		if len(splices) > 0 {
+			header()
+			sortSplices(splices)
+
+			return formatSplices(lines, oldArray, splices, depth)
+		}
+	}
+
+	if isOldMap && oldMap != nil && isChangeMap && changeMap != nil && !isOperationMap(changeMap) {
+		header()
+
+		keys := make([]string, 0, len(changeMap))
+		for key := range changeMap {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			oldChild, doesOldKeyExist := oldMap[key]
+
+			switch {
+			case changeMap[key] == Undefined:
+				if doesOldKeyExist {
+					lines = append(lines, formatLine{marker: formatRemoved, depth: depth, text: key + ": " + formatValue(oldChild)})
+				}
+			case !doesOldKeyExist:
+				lines = append(lines, formatLine{marker: formatAdded, depth: depth, text: key + ": " + formatValue(changeMap[key])})
+			default:
+				lines = formatChange(lines, oldChild, changeMap[key], key, depth)
+			}
+		}
+
+		return lines
+	}
+
+	newValue := Merge(Clone(oldValue), Clone(change), true)
+	if Equal(oldValue, newValue) {
+		return lines
+	}
+
+	text := formatValue(oldValue) + " → " + formatValue(newValue)
+	if delta, ok := parseIncrement(changeMap); isChangeMap && ok {
+		text += " (" + formatIncrement(delta) + ")"
+	}
+
+	if label != "" {
+		text = label + ": " + text
+	}
+
+	return append(lines, formatLine{marker: formatChanged, depth: depth, text: text})
+}
+
+func formatSplices(lines []formatLine, oldArray []any, splices []splice, depth int) []formatLine {
+	// shift is the difference between new and old positions after the previous splices.
+	shift := 0
+
+	for _, splice := range splices {
+		from, length := splice.span.indexFrom, splice.span.length()
+		replacedCount := min(length, len(splice.value))
+
+		for index := range replacedCount {
+			oldIndex := from + index
+			label := "[" + strconv.Itoa(oldIndex) + "]"
+			if shift != 0 {
+				label = "[" + strconv.Itoa(oldIndex) + "→" + strconv.Itoa(oldIndex+shift) + "]"
+			}
+
+			lines = formatChange(lines, oldArray[oldIndex], splice.value[index], label, depth)
+		}
+
+		for index := replacedCount; index < length; index++ {
+			lines = append(lines, formatLine{
+				marker: formatRemoved,
+				depth:  depth,
+				text:   "[" + strconv.Itoa(from+index) + "]: " + formatValue(oldArray[from+index]),
+			})
+		}
+
+		for index := replacedCount; index < len(splice.value); index++ {
+			lines = append(lines, formatLine{
+				marker: formatAdded,
+				depth:  depth,
+				text:   "[" + strconv.Itoa(from+shift+index) + "]: " + formatValue(splice.value[index]),
+			})
+		}
+
+		shift += len(splice.value) - length
+	}
+
+	return lines
+}
+
+func formatValue(value any) string {
+	data, err := MarshalChange(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(data)
+}
+
+func formatIncrement(delta any) string {
+	text := formatValue(delta)
+	if !strings.HasPrefix(text, "-") {
+		text = "+" + text
+	}
+
+	return text
+}
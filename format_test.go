@@ -0,0 +1,110 @@
+package cofly_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestFormat(t *testing.T) {
+	base := map[string]any{
+		"title": "draft",
+		"count": 1,
+		"gone":  true,
+		"tags":  []any{"a", "b"},
+		"items": []any{
+			map[string]any{"id": 1, "name": "one"},
+			"x",
+			"y",
+			"z",
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		change := map[string]any{
+			"title": "final",
+			"count": cofly.Increment(2),
+			"gone":  cofly.Undefined,
+			"new":   map[string]any{"k": 1},
+			"tags":  map[string]any{"$add": []any{"c"}, "$remove": []any{"a"}},
+			"items": map[string]any{
+				"0..":  []any{"first"},
+				"0..1": []any{map[string]any{"name": "uno"}},
+				"2..3": []any{},
+				"4..":  []any{"w"},
+			},
+		}
+
+		want := strings.Join([]string{
+			`~ count: 1 → 3 (+2)`,
+			`- gone: true`,
+			`~ items:`,
+			`  + [0]: "first"`,
+			`  ~ [0→1]:`,
+			`    ~ name: "one" → "uno"`,
+			`  - [2]: "y"`,
+			`  + [4]: "w"`,
+			`+ new: {"k":1}`,
+			`~ tags:`,
+			`  - "a"`,
+			`  + "c"`,
+			`~ title: "draft" → "final"`,
+			``,
+		}, "\n")
+
+		if got := cofly.Format(base, change, cofly.FormatText); got != want {
+			t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("difference-round-trip", func(t *testing.T) {
+		newValue := map[string]any{"title": "draft", "count": 1, "tags": []any{"a", "b"}, "items": []any{"x"}}
+
+		got := cofly.Format(base, cofly.Difference(base, newValue), cofly.FormatText)
+		want := strings.Join([]string{
+			`- gone: true`,
+			`~ items:`,
+			`  - [0]: {"id":1,"name":"one"}`,
+			`  - [2]: "y"`,
+			`  - [3]: "z"`,
+			``,
+		}, "\n")
+
+		if got != want {
+			t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("root-values", func(t *testing.T) {
+		if got := cofly.Format(1, 2, cofly.FormatText); got != "~ 1 → 2\n" {
+			t.Fatalf("unexpected output %q", got)
+		}
+		if got := cofly.Format(1, cofly.Undefined, cofly.FormatText); got != "" {
+			t.Fatalf("unexpected output %q", got)
+		}
+	})
+
+	t.Run("invalid-change", func(t *testing.T) {
+		got := cofly.Format([]any{1}, map[string]any{"3..": []any{2}}, cofly.FormatText)
+		if !strings.HasPrefix(got, "! invalid change") {
+			t.Fatalf("unexpected output %q", got)
+		}
+	})
+
+	t.Run("color", func(t *testing.T) {
+		got := cofly.Format(map[string]any{"a": 1}, map[string]any{"a": cofly.Undefined, "b": 2}, cofly.FormatColor)
+		want := "\x1b[31m- a: 1\x1b[0m\n\x1b[32m+ b: 2\x1b[0m\n"
+		if got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		got := cofly.Format(map[string]any{"a": "<b>"}, map[string]any{"a": "&"}, cofly.FormatHTML)
+		want := "<pre class=\"cofly-diff\">\n<span class=\"cofly-changed\">~ a: &#34;&lt;b&gt;&#34; → &#34;&amp;&#34;</span>\n</pre>\n"
+		if got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package cofly
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	hashNil byte = iota
+	hashBool
+	hashNumber
+	hashString
+	hashArray
+	hashMap
+)
+
+// Hash returns a SHA-256 based structural hash of the value. It follows the rules of Equal:
+// numerically equal numbers of any type hash the same and map key order does not matter.
+// Arrays and maps hash the hashes of their elements, so equal subtrees have equal hashes.
+// Leaves hash like the JSON-shaped value they encode to, so a value hashes the same after
+// an encoding round trip. It panics on unsupported types.
+func Hash(value any) [32]byte {
+	sum, ok := hashValue(value)
+	if !ok {
+		panic(fmt.Sprintf("type [%T] unsupported", value))
+	}
+
+	return sum
+}
+
+// hashValue returns false when the value contains unsupported types.
+func hashValue(value any) ([32]byte, bool) {
+	var buffer []byte
+
+	switch value := value.(type) {
+	case nil:
+		buffer = append(buffer, hashNil)
+	case bool:
+		buffer = append(buffer, hashBool)
+		if value {
+			buffer = append(buffer, 1)
+		} else {
+			buffer = append(buffer, 0)
+		}
+	case
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		// Equal compares numbers of different types as float64, so that is the canonical form.
+		number := toFloat64(value)
+		if number == 0 {
+			number = 0 // -0 equals 0
+		}
+
+		buffer = binary.BigEndian.AppendUint64(append(buffer, hashNumber), math.Float64bits(number))
+	case string:
+		buffer = binary.AppendUvarint(append(buffer, hashString), uint64(len(value)))
+		buffer = append(buffer, value...)
+	case []any:
+		buffer = binary.AppendUvarint(append(buffer, hashArray), uint64(len(value)))
+
+		for _, element := range value {
+			elementHash, ok := hashValue(element)
+			if !ok {
+				return [32]byte{}, false
+			}
+
+			buffer = append(buffer, elementHash[:]...)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		buffer = binary.AppendUvarint(append(buffer, hashMap), uint64(len(value)))
+
+		for _, key := range keys {
+			elementHash, ok := hashValue(value[key])
+			if !ok {
+				return [32]byte{}, false
+			}
+
+			buffer = binary.AppendUvarint(buffer, uint64(len(key)))
+			buffer = append(buffer, key...)
+			buffer = append(buffer, elementHash[:]...)
+		}
+	case []byte:
+		// Equal does not tell nil from empty byte slices, so neither does the hash.
+		return hashValue(base64.StdEncoding.EncodeToString(value))
+	default:
+		if value, ok := normalizeCollection(value); ok {
+			return hashValue(value)
+		}
+
+		// Differ values define their own equality, which a hash cannot follow.
+		if _, ok := asDiffer(value); ok || !isLeaf(value) {
+			return [32]byte{}, false
+		}
+
+		value, err := leafValue(value)
+		if err != nil {
+			return [32]byte{}, false
+		}
+
+		return hashValue(value)
+	}
+
+	return sha256.Sum256(buffer), true
+}
+
+// elementHashes returns the hashes of the array elements when some of them are arrays or maps,
+// so that comparing such elements repeatedly is cheap. It returns nil otherwise,
+// or when an element is not supported (Equal decides about those).
+func elementHashes(array []any) [][32]byte {
+	hasContainers := slices.ContainsFunc(array, func(element any) bool {
+		switch element.(type) {
+		case []any, map[string]any:
+			return true
+		default:
+			_, ok := normalizeCollection(element)
+			return ok
+		}
+	})
+
+	if !hasContainers {
+		return nil
+	}
+
+	hashes := make([][32]byte, len(array))
+	for index, element := range array {
+		hash, ok := hashValue(element)
+		if !ok {
+			return nil
+		}
+
+		hashes[index] = hash
+	}
+
+	return hashes
+}
@@ -0,0 +1,77 @@
+package cofly_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestHash(t *testing.T) {
+	t.Run("equal-values-hash-the-same", func(t *testing.T) {
+		pairs := [][2]any{
+			{1, 1.0},
+			{int8(-3), float32(-3)},
+			{uint64(7), 7},
+			{0.0, math.Copysign(0, -1)},
+			{
+				map[string]any{"a": 1, "b": []any{true, nil, "x"}},
+				map[string]any{"b": []any{true, nil, "x"}, "a": uint8(1)},
+			},
+		}
+
+		for _, pair := range pairs {
+			if !cofly.Equal(pair[0], pair[1]) {
+				t.Fatalf("test values %#v are not equal", pair)
+			}
+			if cofly.Hash(pair[0]) != cofly.Hash(pair[1]) {
+				t.Fatalf("expected equal hashes for %#v and %#v", pair[0], pair[1])
+			}
+		}
+	})
+
+	t.Run("different-values-hash-differently", func(t *testing.T) {
+		values := []any{
+			nil, false, true, 0, 1, "", "1", cofly.Undefined,
+			[]any{}, []any{1}, []any{[]any{1}}, []any{1, 2}, []any{2, 1},
+			map[string]any{}, map[string]any{"a": 1}, map[string]any{"a": 2}, map[string]any{"b": 1},
+			map[string]any{"a": []any{1}}, map[string]any{"ab": "", "": "ab"},
+		}
+
+		seen := map[[32]byte]any{}
+		for _, value := range values {
+			hash := cofly.Hash(value)
+			if previous, ok := seen[hash]; ok {
+				t.Fatalf("%#v and %#v have the same hash", previous, value)
+			}
+			seen[hash] = value
+		}
+	})
+
+	t.Run("unsupported-type-panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected panic")
+			}
+		}()
+
+		cofly.Hash(map[string]any{"a": struct{}{}})
+	})
+}
+
+func FuzzHashEqual(f *testing.F) {
+	f.Add([]byte("seed"), []byte("other"))
+
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		first := genValue(&byteReader{b: a}, 0)
+		second := genValue(&byteReader{b: b}, 0)
+
+		if cofly.Equal(first, second) && cofly.Hash(first) != cofly.Hash(second) {
+			t.Fatalf("equal values %#v and %#v have different hashes", first, second)
+		}
+
+		if cofly.Hash(first) != cofly.Hash(cofly.Clone(first)) {
+			t.Fatalf("clone of %#v has a different hash", first)
+		}
+	})
+}
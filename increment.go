@@ -0,0 +1,151 @@
+package cofly
+
+import "fmt"
+
+// IncrementKey is the only key of an increment change: {"$inc": delta}.
+const IncrementKey = "$inc"
+
+func Increment(delta any) map[string]any {
+	return map[string]any{IncrementKey: delta}
+}
+
+func parseIncrement(changeMap map[string]any) (any, bool) {
+	if len(changeMap) != 1 {
+		return nil, false
+	}
+
+	delta, ok := changeMap[IncrementKey]
+	if !ok {
+		return nil, false
+	}
+
+	switch delta.(type) {
+	case
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return delta, true
+	default:
+		return nil, false
+	}
+}
+
+// mergeIncrement adds delta to a numeric target, treating nil as zero, and panics on other targets.
+// While composing, an increment merged into another increment is composed with it,
+// and a value deleted by the first change counts as nil.
+func mergeIncrement(target any, delta any, isComposing bool) any {
+	switch target := target.(type) {
+	case nil:
+		return delta
+	case
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return addNumbers(target, delta)
+	case string:
+		if isComposing && target == Undefined {
+			return delta
+		}
+	case map[string]any:
+		if targetDelta, ok := parseIncrement(target); ok && isComposing {
+			return Increment(addNumbers(targetDelta, delta))
+		}
+	}
+
+	panic(fmt.Sprintf("increment target type [%T] is not a number", target))
+}
+
+// addNumbers returns target + delta, keeping the type of target when both are integers.
+func addNumbers(target any, delta any) any {
+	switch target.(type) {
+	case int, int8, int16, int32, int64:
+		switch delta.(type) {
+		case int, int8, int16, int32, int64:
+			return convertInt(target, toInt64(target)+toInt64(delta))
+		case uint, uint8, uint16, uint32, uint64:
+			return convertInt(target, toInt64(target)+int64(toUint64(delta)))
+		}
+	case uint, uint8, uint16, uint32, uint64:
+		switch delta.(type) {
+		case int, int8, int16, int32, int64:
+			return convertUint(target, toUint64(target)+uint64(toInt64(delta)))
+		case uint, uint8, uint16, uint32, uint64:
+			return convertUint(target, toUint64(target)+toUint64(delta))
+		}
+	case float32:
+		return float32(toFloat64(target) + toFloat64(delta))
+	}
+
+	return toFloat64(target) + toFloat64(delta)
+}
+
+func convertInt(kind any, value int64) any {
+	switch kind.(type) {
+	case int:
+		return int(value)
+	case int8:
+		return int8(value)
+	case int16:
+		return int16(value)
+	case int32:
+		return int32(value)
+	case int64:
+		return value
+	default:
+		panic(fmt.Sprintf("type [%T] unsupported", kind))
+	}
+}
+
+func convertUint(kind any, value uint64) any {
+	switch kind.(type) {
+	case uint:
+		return uint(value)
+	case uint8:
+		return uint8(value)
+	case uint16:
+		return uint16(value)
+	case uint32:
+		return uint32(value)
+	case uint64:
+		return value
+	default:
+		panic(fmt.Sprintf("type [%T] unsupported", kind))
+	}
+}
+
+// numberDifference returns newValue, or an increment from oldValue to newValue when
+// increments are enabled and adding it back reproduces newValue exactly.
+func (options *DifferenceOptions) numberDifference(oldValue any, newValue any) any {
+	if !options.Increments {
+		return newValue
+	}
+
+	var delta any
+
+	switch newValue.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		switch oldValue.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			delta = int(integerToInt64(newValue) - integerToInt64(oldValue))
+		default:
+			delta = toFloat64(newValue) - toFloat64(oldValue)
+		}
+	default:
+		delta = toFloat64(newValue) - toFloat64(oldValue)
+	}
+
+	if !Equal(addNumbers(oldValue, delta), newValue) {
+		return newValue
+	}
+
+	return Increment(delta)
+}
+
+func integerToInt64(value any) int64 {
+	switch value.(type) {
+	case uint, uint8, uint16, uint32, uint64:
+		return int64(toUint64(value))
+	default:
+		return toInt64(value)
+	}
+}
@@ -0,0 +1,134 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestIncrement(t *testing.T) {
+	t.Run("merge-into-numbers", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			target any
+			delta  any
+			want   any
+		}{
+			{"int", 10, 5, 15},
+			{"int-negative", 10, -15, -5},
+			{"int8-keeps-type", int8(1), 2, int8(3)},
+			{"uint", uint(3), -1, uint(2)},
+			{"float", 1.5, 1, 2.5},
+			{"int-plus-float", 1, 0.5, 1.5},
+			{"float32", float32(1), float32(0.5), float32(1.5)},
+			{"nil-is-zero", nil, 7, 7},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				got := cofly.Merge(tc.target, cofly.Increment(tc.delta), true)
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Fatalf("expected %#v, got %#v", tc.want, got)
+				}
+			})
+		}
+	})
+
+	t.Run("concurrent-increments-commute", func(t *testing.T) {
+		a := map[string]any{"likes": cofly.Increment(1)}
+		b := map[string]any{"likes": cofly.Increment(2)}
+
+		ab := cofly.Merge(cofly.Merge(map[string]any{"likes": 10}, a, true), b, true)
+		ba := cofly.Merge(cofly.Merge(map[string]any{"likes": 10}, b, true), a, true)
+		want := map[string]any{"likes": 13}
+
+		if !reflect.DeepEqual(ab, want) || !reflect.DeepEqual(ba, want) {
+			t.Fatalf("expected %#v, got %#v and %#v", want, ab, ba)
+		}
+	})
+
+	t.Run("increments-compose", func(t *testing.T) {
+		composed := mustCompose(t,
+			map[string]any{"likes": cofly.Increment(1), "views": cofly.Increment(4)},
+			map[string]any{"likes": cofly.Increment(2)},
+		)
+		want := map[string]any{"likes": cofly.Increment(3), "views": cofly.Increment(4)}
+		if !reflect.DeepEqual(composed, want) {
+			t.Fatalf("expected %#v, got %#v", want, composed)
+		}
+	})
+
+	t.Run("non-numeric-targets-panic", func(t *testing.T) {
+		for _, target := range []any{"x", true, []any{1}} {
+			mustPanic(t, func() {
+				_ = cofly.Merge(target, cofly.Increment(1), true)
+			})
+		}
+
+		var target any = map[string]any{"a": "x"}
+		if err := cofly.ApplyAll(&target, []any{map[string]any{"a": cofly.Increment(1)}}, true); !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+	})
+
+	t.Run("objects-with-inc-key-are-data", func(t *testing.T) {
+		got := cofly.Merge(map[string]any{"a": 1}, cofly.Increment(1), true)
+		if want := map[string]any{"a": 1, cofly.IncrementKey: 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+
+		for _, pair := range [][2]any{
+			{map[string]any{"a": map[string]any{}}, map[string]any{"a": cofly.Increment(1)}},
+			{map[string]any{"a": cofly.Increment(1)}, map[string]any{"a": cofly.Increment(3)}},
+			{map[string]any{}, map[string]any{"a": cofly.Increment(1)}},
+		} {
+			oldValue, newValue := pair[0], pair[1]
+
+			change := cofly.Difference(oldValue, newValue)
+			if got := cofly.Merge(cofly.Clone(oldValue), change, true); !reflect.DeepEqual(got, newValue) {
+				t.Fatalf("round-trip from %#v: expected %#v, got %#v", oldValue, newValue, got)
+			}
+		}
+	})
+}
+
+func TestDifferenceIncrements(t *testing.T) {
+	options := cofly.DifferenceOptions{Increments: true}
+
+	t.Run("numeric-fields", func(t *testing.T) {
+		oldValue := map[string]any{"count": 10, "ratio": 0.5, "name": "a", "big": uint64(5)}
+		newValue := map[string]any{"count": 7, "ratio": 0.75, "name": "b", "big": uint64(9)}
+
+		change := cofly.DifferenceWithOptions(oldValue, newValue, options)
+		want := map[string]any{
+			"count": cofly.Increment(-3),
+			"ratio": cofly.Increment(0.25),
+			"name":  "b",
+			"big":   cofly.Increment(4),
+		}
+		if !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		got := cofly.Merge(cofly.Clone(oldValue), change, true)
+		if !reflect.DeepEqual(got, newValue) {
+			t.Fatalf("expected %#v, got %#v", newValue, got)
+		}
+	})
+
+	t.Run("inexact-float-delta-falls-back-to-replacement", func(t *testing.T) {
+		if got := cofly.DifferenceWithOptions(0.1, 0.7, options); got != 0.7 {
+			if !cofly.Equal(cofly.Merge(0.1, got, true), 0.7) {
+				t.Fatalf("change %#v does not reproduce the new value", got)
+			}
+		}
+	})
+
+	t.Run("disabled-by-default", func(t *testing.T) {
+		if got := cofly.Difference(1, 2); got != 2 {
+			t.Fatalf("expected 2, got %#v", got)
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package cofly
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Change struct {
+	Value any
+}
+
+func (c Change) MarshalJSON() ([]byte, error) {
+	return MarshalChange(c.Value)
+}
+
+func (c *Change) UnmarshalJSON(data []byte) error {
+	value, err := UnmarshalChange(data)
+	if err != nil {
+		return err
+	}
+
+	c.Value = value
+	return nil
+}
+
+func MarshalChange(change any) ([]byte, error) {
+	return appendJSON(nil, change)
+}
+
+func UnmarshalChange(data []byte) (any, error) {
+	decoder := newJSONDecoder(bytes.NewReader(data))
+
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid change: unexpected data after top-level value")
+	}
+
+	return value, nil
+}
+
+func MergeJSON(target any, r io.Reader, doClean bool) (any, error) {
+	decoder := newJSONDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := mergeJSONToken(decoder, target, token, doClean)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid change: unexpected data after top-level value")
+	}
+
+	return output, nil
+}
+
+// mergeJSONToken applies the change starting at token onto target. Object changes are
+// merged into map targets key by key as they are read; everything else is decoded first
+// and handed over to Merge.
+func mergeJSONToken(decoder *json.Decoder, target any, token json.Token, doClean bool) (any, error) {
+	targetMap, isTargetMap := target.(map[string]any)
+
+	if token != json.Delim('{') || !isTargetMap || targetMap == nil {
+		change, err := decodeJSONToken(decoder, token)
+		if err != nil {
+			return nil, err
+		}
+
+		return tryMerge(target, change, doClean)
+	}
+
+	for isFirstKey := true; decoder.More(); isFirstKey = false {
+		key, err := decodeJSONKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		// Splice-maps, increments and set changes have only such keys and are not merged
+		// key by key, so the object is decoded first and handed over to Merge.
+		if isFirstKey && isOperationKey(key) {
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			change, err := decodeJSONObject(decoder, map[string]any{key: value})
+			if err != nil {
+				return nil, err
+			}
+
+			return tryMerge(targetMap, change, doClean)
+		}
+
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if token == Undefined {
+			if doClean {
+				delete(targetMap, key)
+			} else {
+				targetMap[key] = Undefined
+			}
+
+			continue
+		}
+
+		targetValue, doesTargetValueExist := targetMap[key]
+		if !doesTargetValueExist {
+			changeValue, err := decodeJSONToken(decoder, token)
+			if err != nil {
+				return nil, err
+			}
+
+			targetMap[key] = changeValue
+			continue
+		}
+
+		outputValue, err := mergeJSONToken(decoder, targetValue, token, doClean)
+		if err != nil {
+			return nil, err
+		}
+
+		targetMap[key] = outputValue
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return targetMap, nil
+}
+
+func newJSONDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+func decodeJSONValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSONToken(decoder, token)
+}
+
+// decodeJSONObject reads the remaining keys of an object into it, up to the closing brace.
+func decodeJSONObject(decoder *json.Decoder, object map[string]any) (any, error) {
+	for decoder.More() {
+		key, err := decodeJSONKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decodeJSONValue(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		object[key] = value
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// isOperationKey reports whether the key can belong to a splice-map, an increment or a set change.
+func isOperationKey(key string) bool {
+	if _, ok := parseSpan(key); ok {
+		return true
+	}
+
+	return key == IncrementKey || key == SetAddKey || key == SetRemoveKey
+}
+
+func decodeJSONToken(decoder *json.Decoder, token json.Token) (any, error) {
+	switch token := token.(type) {
+	case nil, bool, string:
+		return token, nil
+	case json.Number:
+		return parseJSONNumber(token)
+	case json.Delim:
+		switch token {
+		case '{':
+			return decodeJSONObject(decoder, make(map[string]any))
+		case '[':
+			array := make([]any, 0)
+
+			for decoder.More() {
+				value, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, value)
+			}
+
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+
+			return array, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid change: unexpected token %v", token)
+}
+
+func decodeJSONKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid change: unexpected object key %v", token)
+	}
+
+	return key, nil
+}
+
+// parseJSONNumber keeps integers as int (or uint64 when they do not fit),
+// and everything else as float64.
+func parseJSONNumber(number json.Number) (any, error) {
+	text := number.String()
+
+	if !strings.ContainsAny(text, ".eE") {
+		if value, err := strconv.ParseInt(text, 10, 0); err == nil {
+			return int(value), nil
+		}
+
+		if value, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return value, nil
+		}
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid change: number %s: %w", text, err)
+	}
+
+	return value, nil
+}
+
+func appendJSON(buffer []byte, value any) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(buffer, "null"...), nil
+	case bool:
+		return strconv.AppendBool(buffer, value), nil
+	case int, int8, int16, int32, int64:
+		return strconv.AppendInt(buffer, toInt64(value), 10), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return strconv.AppendUint(buffer, toUint64(value), 10), nil
+	case float32:
+		return appendJSONFloat(buffer, float64(value), 32)
+	case float64:
+		return appendJSONFloat(buffer, value, 64)
+	case string:
+		return appendJSONString(buffer, value), nil
+	case map[string]any:
+		if value == nil {
+			return append(buffer, "null"...), nil
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		buffer = append(buffer, '{')
+
+		for index, key := range keys {
+			if index > 0 {
+				buffer = append(buffer, ',')
+			}
+
+			buffer = appendJSONString(buffer, key)
+			buffer = append(buffer, ':')
+
+			var err error
+			buffer, err = appendJSON(buffer, value[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return append(buffer, '}'), nil
+	case []any:
+		if value == nil {
+			return append(buffer, "null"...), nil
+		}
+
+		buffer = append(buffer, '[')
+
+		for index, element := range value {
+			if index > 0 {
+				buffer = append(buffer, ',')
+			}
+
+			var err error
+			buffer, err = appendJSON(buffer, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return append(buffer, ']'), nil
+	case Splices:
+		if value == nil {
+			return appendJSON(buffer, nil)
+		}
+
+		return appendJSON(buffer, value.Map())
+	default:
+		if value, ok := normalizeCollection(value); ok {
+			return appendJSON(buffer, value)
+		}
+
+		if isLeaf(value) {
+			data, err := leafJSON(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return append(buffer, data...), nil
+		}
+
+		return nil, fmt.Errorf("type [%T] unsupported", value)
+	}
+}
+
+// appendJSONFloat formats floats the same way encoding/json does.
+func appendJSONFloat(buffer []byte, value float64, bits int) ([]byte, error) {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, fmt.Errorf("float value %v unsupported", value)
+	}
+
+	format := byte('f')
+
+	if abs := math.Abs(value); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	buffer = strconv.AppendFloat(buffer, value, format, -1, bits)
+
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(buffer)
+		if n >= 4 && buffer[n-4] == 'e' && buffer[n-3] == '-' && buffer[n-2] == '0' {
+			buffer[n-2] = buffer[n-1]
+			buffer = buffer[:n-1]
+		}
+	}
+
+	return buffer, nil
+}
+
+func appendJSONString(buffer []byte, value string) []byte {
+	const hex = "0123456789abcdef"
+
+	buffer = append(buffer, '"')
+
+	for index := 0; index < len(value); {
+		if char := value[index]; char < utf8.RuneSelf {
+			switch {
+			case char == '"' || char == '\\':
+				buffer = append(buffer, '\\', char)
+			case char == '\n':
+				buffer = append(buffer, '\\', 'n')
+			case char == '\r':
+				buffer = append(buffer, '\\', 'r')
+			case char == '\t':
+				buffer = append(buffer, '\\', 't')
+			case char < 0x20:
+				buffer = append(buffer, '\\', 'u', '0', '0', hex[char>>4], hex[char&0xF])
+			default:
+				buffer = append(buffer, char)
+			}
+
+			index++
+			continue
+		}
+
+		char, size := utf8.DecodeRuneInString(value[index:])
+
+		switch {
+		case char == utf8.RuneError && size == 1:
+			buffer = append(buffer, `\ufffd`...)
+		case char == '\u2028' || char == '\u2029':
+			buffer = append(buffer, '\\', 'u', '2', '0', '2', hex[char&0xF])
+		default:
+			buffer = append(buffer, value[index:index+size]...)
+		}
+
+		index += size
+	}
+
+	return append(buffer, '"')
+}
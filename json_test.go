@@ -0,0 +1,225 @@
+package cofly_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestMarshalChange(t *testing.T) {
+	t.Run("canonical-output", func(t *testing.T) {
+		change := map[string]any{
+			"b":    cofly.Undefined,
+			"a":    []any{1, 2.5, "x<y>"},
+			"list": map[string]any{"1..2": []any{"B"}, "3..": []any{}},
+			"nil":  nil,
+			"ok":   true,
+		}
+		want := `{"a":[1,2.5,"x<y>"],"b":"\u0000","list":{"1..2":["B"],"3..":[]},"nil":null,"ok":true}`
+
+		got, err := cofly.MarshalChange(change)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("floats-match-encoding-json", func(t *testing.T) {
+		for _, value := range []any{1.0, 0.1, 1e21, 1e-7, float32(0.1), -0.5} {
+			got, err := cofly.MarshalChange(value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want, _ := json.Marshal(value)
+			if string(got) != string(want) {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		}
+	})
+
+	t.Run("unsupported-types-error", func(t *testing.T) {
+		type S struct{ A int }
+		if _, err := cofly.MarshalChange(map[string]any{"s": S{A: 1}}); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestUnmarshalChange(t *testing.T) {
+	t.Run("numbers", func(t *testing.T) {
+		got, err := cofly.UnmarshalChange([]byte(`[1, -2, 2.5, 1e3, 18446744073709551615]`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []any{1, -2, 2.5, 1000.0, uint64(18446744073709551615)}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("undefined-and-splices-round-trip", func(t *testing.T) {
+		change := map[string]any{
+			"gone":  cofly.Undefined,
+			"items": map[string]any{"0..1": []any{"x"}, "2..": []any{map[string]any{"a": 1}}},
+		}
+
+		data, err := cofly.MarshalChange(change)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := cofly.UnmarshalChange(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, change) {
+			t.Fatalf("expected %#v, got %#v", change, got)
+		}
+
+		target := map[string]any{"gone": 1, "items": []any{"a", "b"}}
+		want := map[string]any{"items": []any{"x", "b", map[string]any{"a": 1}}}
+		if merged := cofly.Merge(target, got, true); !reflect.DeepEqual(merged, want) {
+			t.Fatalf("expected %#v, got %#v", want, merged)
+		}
+	})
+
+	t.Run("invalid-input-errors", func(t *testing.T) {
+		for _, data := range []string{``, `{`, `[1,]`, `1 2`, `{"a":1}}`} {
+			if _, err := cofly.UnmarshalChange([]byte(data)); err == nil {
+				t.Fatalf("expected error for %q", data)
+			}
+		}
+	})
+}
+
+func TestChangeJSON(t *testing.T) {
+	type envelope struct {
+		Version int          `json:"version"`
+		Change  cofly.Change `json:"change"`
+	}
+
+	in := envelope{Version: 3, Change: cofly.Change{Value: map[string]any{"a": cofly.Undefined, "b": 2}}}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"version":3,"change":{"a":"\u0000","b":2}}`; string(data) != want {
+		t.Fatalf("expected %s, got %s", want, data)
+	}
+
+	var out envelope
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("expected %#v, got %#v", in, out)
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	t.Run("matches-merge", func(t *testing.T) {
+		target := map[string]any{
+			"a":      1,
+			"b":      2,
+			"nested": map[string]any{"x": 1, "y": []any{"a", "b", "c"}},
+			"list":   []any{map[string]any{"v": 1}, "z"},
+		}
+		change := map[string]any{
+			"b":      cofly.Undefined,
+			"c":      map[string]any{"new": true},
+			"nested": map[string]any{"x": 2.5, "y": map[string]any{"1..2": []any{}, "3..": []any{"d"}}},
+			"list":   map[string]any{"0..1": []any{map[string]any{"v": 2}}},
+		}
+
+		data, err := cofly.MarshalChange(change)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, doClean := range []bool{true, false} {
+			want := cofly.Merge(cofly.Clone(target), cofly.Clone(change), doClean)
+
+			got, err := cofly.MergeJSON(cofly.Clone(target), bytes.NewReader(data), doClean)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("doClean=%v: expected %#v, got %#v", doClean, want, got)
+			}
+		}
+	})
+
+	t.Run("matches-merge-for-operations", func(t *testing.T) {
+		target := map[string]any{"m": map[string]any{"k": 1}, "n": 1, "tags": []any{"a"}}
+
+		for _, data := range []string{
+			`{"m":{"0..":[1]}}`,
+			`{"m":{"0..1":"x"}}`,
+			`{"m":{"0..":[1],"k":2}}`,
+			`{"m":{"k":2,"0..":[1]}}`,
+			`{"m":{"$inc":1}}`,
+			`{"m":{"$add":["x"]}}`,
+			`{"n":{"$inc":2}}`,
+			`{"count":{"$inc":2}}`,
+			`{"tags":{"$add":["b"],"$remove":["a"]}}`,
+			`{"labels":{"$add":["b"]}}`,
+			`{"0..":["x"]}`,
+		} {
+			change, err := cofly.UnmarshalChange([]byte(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := cofly.Clone(target)
+			wantErr := cofly.ApplyAll(&want, []any{change}, true)
+
+			got, err := cofly.MergeJSON(cofly.Clone(target), strings.NewReader(data), true)
+			if errors.Is(err, cofly.ErrInvalidChange) != errors.Is(wantErr, cofly.ErrInvalidChange) {
+				t.Fatalf("%s: expected error %v, got %v", data, wantErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: expected %#v, got %#v", data, want, got)
+			}
+		}
+	})
+
+	t.Run("replacements", func(t *testing.T) {
+		got, err := cofly.MergeJSON([]any{"a"}, strings.NewReader(`{"a":1}`), true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := map[string]any{"a": 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+
+		got, err = cofly.MergeJSON("x", strings.NewReader(`"\u0000"`), true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != "x" {
+			t.Fatalf("expected x, got %#v", got)
+		}
+	})
+
+	t.Run("invalid-change-returns-error", func(t *testing.T) {
+		target := map[string]any{"list": []any{"a"}}
+
+		if _, err := cofly.MergeJSON(target, strings.NewReader(`{"list":{"5..":["x"]}}`), true); err == nil {
+			t.Fatalf("expected error for out-of-range span")
+		}
+		if _, err := cofly.MergeJSON(target, strings.NewReader(`{"list":`), true); err == nil {
+			t.Fatalf("expected error for truncated input")
+		}
+		if _, err := cofly.MergeJSON(target, strings.NewReader(`{} {}`), true); err == nil {
+			t.Fatalf("expected error for trailing data")
+		}
+	})
+}
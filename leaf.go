@@ -0,0 +1,152 @@
+package cofly
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// isLeaf reports whether the value is an atomic value that is not JSON-shaped:
+// a time.Time, a []byte, or a json.Marshaler or encoding.TextMarshaler.
+func isLeaf(value any) bool {
+	switch value.(type) {
+	case nil,
+		bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64,
+		string,
+		map[string]any,
+		[]any,
+		Splices:
+		return false
+	case time.Time, []byte, json.Marshaler, encoding.TextMarshaler:
+		return true
+	default:
+		return false
+	}
+}
+
+// areLeavesEqual compares times by instant, byte slices bytewise and other leaves by their JSON encoding.
+func areLeavesEqual(oldValue, newValue any) bool {
+	if !isLeaf(oldValue) || !isLeaf(newValue) {
+		return false
+	}
+
+	switch newValue := newValue.(type) {
+	case time.Time:
+		oldValue, ok := oldValue.(time.Time)
+		return ok && newValue.Equal(oldValue)
+	case []byte:
+		oldValue, ok := oldValue.([]byte)
+		return ok && bytes.Equal(newValue, oldValue)
+	}
+
+	switch oldValue.(type) {
+	case time.Time, []byte:
+		return false
+	}
+
+	oldJSON, err := leafJSON(oldValue)
+	if err != nil {
+		return false
+	}
+
+	newJSON, err := leafJSON(newValue)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(oldJSON, newJSON)
+}
+
+func cloneLeaf(value any) any {
+	if value, ok := value.([]byte); ok && value != nil {
+		return bytes.Clone(value)
+	}
+
+	// Times and marshalers are treated as immutable.
+	return value
+}
+
+// leafJSON encodes a leaf the way encoding/json does: []byte as base64 and TextMarshalers as strings.
+// Times are RFC 3339 strings in UTC, so equal instants encode the same.
+func leafJSON(value any) ([]byte, error) {
+	if reflectValue := reflect.ValueOf(value); reflectValue.Kind() == reflect.Pointer && reflectValue.IsNil() {
+		return []byte("null"), nil
+	}
+
+	switch value := value.(type) {
+	case time.Time:
+		return value.UTC().MarshalJSON()
+	case []byte:
+		if value == nil {
+			return []byte("null"), nil
+		}
+
+		buffer := append(make([]byte, 0, base64.StdEncoding.EncodedLen(len(value))+2), '"')
+		buffer = base64.StdEncoding.AppendEncode(buffer, value)
+		return append(buffer, '"'), nil
+	case json.Marshaler:
+		data, err := value.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		var buffer bytes.Buffer
+		if err := json.Compact(&buffer, data); err != nil {
+			return nil, fmt.Errorf("type [%T] marshals invalid JSON: %w", value, err)
+		}
+
+		return buffer.Bytes(), nil
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+
+		return appendJSONString(nil, string(text)), nil
+	default:
+		return nil, fmt.Errorf("type [%T] unsupported", value)
+	}
+}
+
+// leafValue returns the JSON-shaped value a leaf encodes to, for the binary encodings and Hash.
+func leafValue(value any) (any, error) {
+	data, err := leafJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnmarshalChange(data)
+}
+
+// leafDifference replaces a leaf, or replaces a value with a leaf, unless they are equal.
+func leafDifference(oldValue, newValue any) any {
+	if areLeavesEqual(oldValue, newValue) {
+		return Undefined
+	}
+
+	for _, value := range []any{oldValue, newValue} {
+		switch value.(type) {
+		case nil,
+			bool,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64,
+			string,
+			map[string]any,
+			[]any:
+		default:
+			if !isLeaf(value) {
+				panic(fmt.Sprintf("type [%T] unsupported", value))
+			}
+		}
+	}
+
+	return newValue
+}
@@ -0,0 +1,215 @@
+package cofly_test
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestLeavesEqual(t *testing.T) {
+	instant := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	testCases := []struct {
+		name     string
+		oldValue any
+		newValue any
+		expected bool
+	}{
+		{"same-instant-other-zone", instant, instant.In(time.FixedZone("X", 3600)), true},
+		{"different-instants", instant, instant.Add(time.Nanosecond), false},
+		{"time-and-string", instant, instant.Format(time.RFC3339Nano), false},
+		{"bytes", []byte{1, 2}, []byte{1, 2}, true},
+		{"different-bytes", []byte{1, 2}, []byte{1, 3}, false},
+		{"bytes-and-array", []byte{1, 2}, []any{1, 2}, false},
+		{"json-marshalers", big.NewInt(42), big.NewInt(42), true},
+		{"different-json-marshalers", big.NewInt(42), big.NewInt(43), false},
+		{"text-marshalers", net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1"), true},
+		{"text-marshaler-and-string", net.ParseIP("10.0.0.1"), "10.0.0.1", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := cofly.Equal(testCase.oldValue, testCase.newValue); actual != testCase.expected {
+				t.Fatalf("expected %v, got %v", testCase.expected, actual)
+			}
+
+			if actual := cofly.Equal(testCase.newValue, testCase.oldValue); actual != testCase.expected {
+				t.Fatalf("expected %v reversed, got %v", testCase.expected, actual)
+			}
+
+			if testCase.expected && cofly.Hash(testCase.oldValue) != cofly.Hash(testCase.newValue) {
+				t.Fatalf("expected equal hashes")
+			}
+		})
+	}
+}
+
+func TestLeavesCloneDifferenceMerge(t *testing.T) {
+	instant := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hash := []byte{0xde, 0xad}
+
+	oldValue := map[string]any{"at": instant, "hash": hash, "id": big.NewInt(1)}
+
+	cloned := cofly.Clone(oldValue).(map[string]any)
+	cloned["hash"].([]byte)[0] = 0
+	if hash[0] != 0xde {
+		t.Fatalf("cloned bytes share memory with the source")
+	}
+
+	if change := cofly.Difference(oldValue, map[string]any{
+		"at":   instant.In(time.FixedZone("X", 3600)),
+		"hash": []byte{0xde, 0xad},
+		"id":   big.NewInt(1),
+	}); change != cofly.Undefined {
+		t.Fatalf("expected Undefined, got %#v", change)
+	}
+
+	newValue := map[string]any{"at": instant.Add(time.Hour), "hash": []byte{0xbe, 0xef}, "id": "none"}
+
+	change := cofly.Difference(oldValue, newValue)
+	if !reflect.DeepEqual(change, newValue) {
+		t.Fatalf("expected every leaf to be replaced, got %#v", change)
+	}
+
+	output := cofly.Merge(cofly.Clone(oldValue), change, true)
+	if !cofly.Equal(output, newValue) {
+		t.Fatalf("expected %#v, got %#v", newValue, output)
+	}
+
+	if output := cofly.Merge(instant, map[string]any{"a": 1}, true); !cofly.Equal(output, map[string]any{"a": 1}) {
+		t.Fatalf("expected an object to replace a leaf, got %#v", output)
+	}
+
+	if _, err := (cofly.Limits{}).Merge([]byte{1}, map[string]any{"0..1": []any{2}}, true); err == nil {
+		t.Fatalf("expected splices into a leaf to fail")
+	}
+}
+
+func TestLeavesEncoding(t *testing.T) {
+	instant := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	value := map[string]any{"at": instant, "hash": []byte("hi"), "id": big.NewInt(7), "ip": net.ParseIP("10.0.0.1")}
+
+	t.Run("json", func(t *testing.T) {
+		data, err := cofly.MarshalChange(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := `{"at":"2024-05-01T12:00:00.123456789Z","hash":"aGk=","id":7,"ip":"10.0.0.1"}`
+		if string(data) != expected {
+			t.Fatalf("expected %s, got %s", expected, data)
+		}
+
+		if size := cofly.EncodedSize(value); size != len(data) {
+			t.Fatalf("expected EncodedSize %d, got %d", len(data), size)
+		}
+	})
+
+	t.Run("cbor", func(t *testing.T) {
+		data, err := cofly.MarshalCBOR(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		decoded, err := cofly.UnmarshalCBOR(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := map[string]any{"at": instant, "hash": []byte("hi"), "id": 7, "ip": "10.0.0.1"}
+		if !cofly.Equal(decoded, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, decoded)
+		}
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		data, err := cofly.MarshalMsgpack(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		decoded, err := cofly.UnmarshalMsgpack(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := map[string]any{"at": instant, "hash": []byte("hi"), "id": 7, "ip": "10.0.0.1"}
+		if !cofly.Equal(decoded, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, decoded)
+		}
+	})
+
+	t.Run("msgpack-timestamp-32", func(t *testing.T) {
+		decoded, err := cofly.UnmarshalMsgpack([]byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x3c})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !cofly.Equal(decoded, time.Unix(60, 0)) {
+			t.Fatalf("unexpected time %v", decoded)
+		}
+	})
+
+	t.Run("cbor-byte-string", func(t *testing.T) {
+		data, err := cofly.MarshalCBOR([]byte{1, 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(data, []byte{0x42, 1, 2}) {
+			t.Fatalf("unexpected encoding % x", data)
+		}
+	})
+}
+
+func TestLeavesChecksumRoundTrip(t *testing.T) {
+	instant := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.FixedZone("X", 3600))
+	value := map[string]any{"at": instant, "hash": []byte("hi"), "id": big.NewInt(7), "ip": net.ParseIP("10.0.0.1")}
+	newValue := map[string]any{"at": instant.Add(time.Hour), "hash": []byte("bye"), "id": big.NewInt(8), "ip": "none"}
+	change := cofly.Difference(value, newValue)
+
+	codecs := []struct {
+		name      string
+		marshal   func(any) ([]byte, error)
+		unmarshal func([]byte) (any, error)
+	}{
+		{"json", cofly.MarshalChange, cofly.UnmarshalChange},
+		{"msgpack", cofly.MarshalMsgpack, cofly.UnmarshalMsgpack},
+		{"cbor", cofly.MarshalCBOR, cofly.UnmarshalCBOR},
+	}
+
+	for _, codec := range codecs {
+		t.Run(codec.name, func(t *testing.T) {
+			roundTrip := func(value any) any {
+				data, err := codec.marshal(value)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				decoded, err := codec.unmarshal(data)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return decoded
+			}
+
+			replica := cofly.NewReplica()
+
+			snapshot := cofly.VersionedChange{Version: 1, Change: roundTrip(value)}
+			if err := replica.Apply(true, snapshot, cofly.Checksum(value)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			update := cofly.VersionedChange{PreviousVersion: 1, Version: 2, Change: roundTrip(change)}
+			if err := replica.Apply(false, update, cofly.Checksum(newValue)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package cofly
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var (
+	ErrCycle      = errors.New("cycle detected")
+	ErrDepthLimit = errors.New("depth limit exceeded")
+	ErrSizeLimit  = errors.New("size limit exceeded")
+)
+
+// DefaultMaxDepth is the depth limit used when Limits.MaxDepth is zero.
+const DefaultMaxDepth = 10000
+
+// Limits guards the functions of the package against values they cannot process safely:
+// its methods check their arguments first and return an error instead of overflowing the stack.
+// Cycles are always detected; zero limits are unlimited, except MaxDepth.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of maps and arrays (a flat map has depth 1),
+	// DefaultMaxDepth when zero.
+	MaxDepth int
+	// MaxSize is the maximum number of values, counting every map, array and leaf.
+	MaxSize int
+
+	// The limits below are enforced by Merge and ApplyAll while merging, per change.
+
+	// MaxSplices is the maximum number of array and string splices.
+	MaxSplices int
+	// MaxSpliceElements is the maximum number of elements in the values of array splices.
+	MaxSpliceElements int
+	// MaxObjectKeys is the maximum number of keys of the objects merged key by key.
+	MaxObjectKeys int
+	// MaxArrayLength is the maximum length of an array produced by splices, checked before it is allocated.
+	MaxArrayLength int
+}
+
+// Check returns an error wrapping ErrCycle, ErrDepthLimit or ErrSizeLimit when the value
+// contains a cycle or exceeds the limits.
+func (l Limits) Check(value any) error {
+	checker := limitsChecker{limits: l, visiting: map[limitsKey]struct{}{}}
+	return checker.check(value)
+}
+
+func (l Limits) Clone(value any) (any, error) {
+	if err := l.Check(value); err != nil {
+		return nil, err
+	}
+
+	return Clone(value), nil
+}
+
+func (l Limits) Equal(oldValue, newValue any) (bool, error) {
+	if err := l.checkAll(oldValue, newValue); err != nil {
+		return false, err
+	}
+
+	return Equal(oldValue, newValue), nil
+}
+
+func (l Limits) Difference(oldValue, newValue any, options DifferenceOptions) (any, error) {
+	if err := l.checkAll(oldValue, newValue); err != nil {
+		return nil, err
+	}
+
+	return DifferenceWithOptions(oldValue, newValue, options), nil
+}
+
+// Merge is Merge with checked arguments; invalid changes return an error wrapping ErrInvalidChange.
+// Like Merge, it modifies the target in place, also when it fails: use ApplyAll to roll back.
+func (l Limits) Merge(target, change any, doClean bool) (any, error) {
+	if err := l.checkAll(target, change); err != nil {
+		return nil, err
+	}
+
+	return (&merger{doClean: doClean, limits: l}).tryMerge(target, change)
+}
+
+// ApplyAll is ApplyAll with checked changes.
+func (l Limits) ApplyAll(target *any, changes []any, doClean bool) error {
+	output, err := tryClone(*target)
+	if err != nil {
+		return err
+	}
+
+	for index, change := range changes {
+		err := l.Check(change)
+		if err == nil {
+			change, err = tryClone(change)
+		}
+
+		if err == nil {
+			output, err = (&merger{doClean: doClean, limits: l}).tryMerge(output, change)
+		}
+
+		if err != nil {
+			return fmt.Errorf("change %d: %w", index, err)
+		}
+	}
+
+	*target = output
+	return nil
+}
+
+func (l Limits) checkAll(values ...any) error {
+	for _, value := range values {
+		if err := l.Check(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitsKey identifies a map, or a slice by its first element and length.
+type limitsKey struct {
+	pointer uintptr
+	length  int
+}
+
+type limitsChecker struct {
+	limits   Limits
+	size     int
+	visiting map[limitsKey]struct{}
+	// path is the path of the value being checked, shared by the recursive calls.
+	path []string
+}
+
+func (c *limitsChecker) check(value any) error {
+	c.size++
+	if c.limits.MaxSize > 0 && c.size > c.limits.MaxSize {
+		return fmt.Errorf("%w: more than %d values", ErrSizeLimit, c.limits.MaxSize)
+	}
+
+	var key limitsKey
+
+	// Typed collections are identified by the original value, not by its normalized copy.
+	original := value
+	pointer := func() uintptr { return reflect.ValueOf(original).Pointer() }
+	value = normalize(value)
+
+	switch value := value.(type) {
+	case map[string]any:
+		if len(value) == 0 {
+			return c.checkDepth()
+		}
+
+		key = limitsKey{pointer: pointer(), length: -1}
+	case []any:
+		if len(value) == 0 {
+			return c.checkDepth()
+		}
+
+		key = limitsKey{pointer: pointer(), length: len(value)}
+	case Splices:
+		if err := c.checkDepth(); err != nil {
+			return err
+		}
+
+		for _, splice := range value {
+			if err := c.checkChild(splice.Values, splice.Span().String()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return nil
+	}
+
+	if err := c.checkDepth(); err != nil {
+		return err
+	}
+
+	if _, ok := c.visiting[key]; ok {
+		return fmt.Errorf("%w at %q", ErrCycle, formatPath(c.path))
+	}
+
+	c.visiting[key] = struct{}{}
+	defer delete(c.visiting, key)
+
+	switch value := value.(type) {
+	case map[string]any:
+		for childKey, child := range value {
+			if err := c.checkChild(child, childKey); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for index, child := range value {
+			if err := c.checkChild(child, strconv.Itoa(index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *limitsChecker) checkChild(child any, key string) error {
+	c.path = append(c.path, key)
+	err := c.check(child)
+	c.path = c.path[:len(c.path)-1]
+	return err
+}
+
+// checkDepth is called for a container at c.path, whose depth is len(c.path)+1.
+func (c *limitsChecker) checkDepth() error {
+	maxDepth := c.limits.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	if len(c.path)+1 > maxDepth {
+		return fmt.Errorf("%w at %q: deeper than %d", ErrDepthLimit, formatPath(c.path), maxDepth)
+	}
+
+	return nil
+}
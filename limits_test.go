@@ -0,0 +1,245 @@
+package cofly_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	t.Run("accepts-value-within-limits", func(t *testing.T) {
+		limits := cofly.Limits{MaxDepth: 3, MaxSize: 6}
+		value := map[string]any{"a": []any{1, map[string]any{"b": 2}}}
+
+		if err := limits.Check(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("zero-max-depth-is-default", func(t *testing.T) {
+		var value any = "leaf"
+		for range cofly.DefaultMaxDepth {
+			value = []any{value}
+		}
+
+		if err := (cofly.Limits{}).Check(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		value = []any{value}
+		if err := (cofly.Limits{}).Check(value); !errors.Is(err, cofly.ErrDepthLimit) {
+			t.Fatalf("expected ErrDepthLimit, got %v", err)
+		}
+
+		target := any(nil)
+		if err := cofly.ApplyAll(&target, []any{value}, true); !errors.Is(err, cofly.ErrDepthLimit) {
+			t.Fatalf("expected ErrDepthLimit, got %v", err)
+		}
+	})
+
+	t.Run("rejects-deep-value", func(t *testing.T) {
+		limits := cofly.Limits{MaxDepth: 2}
+		value := map[string]any{"a": map[string]any{"b": map[string]any{}}}
+
+		err := limits.Check(value)
+		if !errors.Is(err, cofly.ErrDepthLimit) {
+			t.Fatalf("expected ErrDepthLimit, got %v", err)
+		}
+		if !strings.Contains(err.Error(), `"/a/b"`) {
+			t.Fatalf("expected error to name the path, got %v", err)
+		}
+	})
+
+	t.Run("rejects-large-value", func(t *testing.T) {
+		limits := cofly.Limits{MaxSize: 3}
+		value := []any{1, 2, 3}
+
+		if err := limits.Check(value); !errors.Is(err, cofly.ErrSizeLimit) {
+			t.Fatalf("expected ErrSizeLimit, got %v", err)
+		}
+	})
+
+	t.Run("rejects-map-cycle", func(t *testing.T) {
+		value := map[string]any{"a": map[string]any{}}
+		value["a"].(map[string]any)["self"] = value
+
+		err := (cofly.Limits{}).Check(value)
+		if !errors.Is(err, cofly.ErrCycle) {
+			t.Fatalf("expected ErrCycle, got %v", err)
+		}
+		if !strings.Contains(err.Error(), `"/a/self"`) {
+			t.Fatalf("expected error to name the path, got %v", err)
+		}
+	})
+
+	t.Run("rejects-array-cycle", func(t *testing.T) {
+		value := []any{nil, 1}
+		value[0] = value
+
+		if err := (cofly.Limits{}).Check(value); !errors.Is(err, cofly.ErrCycle) {
+			t.Fatalf("expected ErrCycle, got %v", err)
+		}
+	})
+
+	t.Run("accepts-shared-subtrees", func(t *testing.T) {
+		shared := map[string]any{"x": 1}
+		value := map[string]any{"a": shared, "b": []any{shared, shared}}
+
+		if err := (cofly.Limits{}).Check(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("checks-splice-values", func(t *testing.T) {
+		limits := cofly.Limits{MaxDepth: 2}
+		change := cofly.Splices{{From: 0, To: 0, Values: []any{[]any{[]any{}}}}}
+
+		if err := limits.Check(change); !errors.Is(err, cofly.ErrDepthLimit) {
+			t.Fatalf("expected ErrDepthLimit, got %v", err)
+		}
+	})
+}
+
+func TestLimitsOperations(t *testing.T) {
+	cyclic := map[string]any{}
+	cyclic["self"] = cyclic
+
+	limits := cofly.Limits{MaxDepth: 8}
+
+	if _, err := limits.Clone(cyclic); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("Clone: expected ErrCycle, got %v", err)
+	}
+
+	if _, err := limits.Equal(map[string]any{}, cyclic); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("Equal: expected ErrCycle, got %v", err)
+	}
+
+	if _, err := limits.Difference(cyclic, map[string]any{}, cofly.DifferenceOptions{}); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("Difference: expected ErrCycle, got %v", err)
+	}
+
+	if _, err := limits.Merge(map[string]any{}, cyclic, true); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("Merge: expected ErrCycle, got %v", err)
+	}
+
+	if _, err := limits.Merge([]any{1}, map[string]any{"5..6": []any{2}}, true); !errors.Is(err, cofly.ErrInvalidChange) {
+		t.Fatalf("Merge: expected ErrInvalidChange, got %v", err)
+	}
+
+	output, err := limits.Merge(map[string]any{"a": 1}, map[string]any{"b": 2}, true)
+	if err != nil {
+		t.Fatalf("Merge: unexpected error: %v", err)
+	}
+	if !cofly.Equal(output, map[string]any{"a": 1, "b": 2}) {
+		t.Fatalf("Merge: unexpected output %#v", output)
+	}
+
+	isEqual, err := limits.Equal([]any{1, 2}, []any{1.0, 2})
+	if err != nil || !isEqual {
+		t.Fatalf("Equal: expected true, got %v, %v", isEqual, err)
+	}
+
+	change, err := limits.Difference(map[string]any{"a": 1}, map[string]any{"a": 2}, cofly.DifferenceOptions{})
+	if err != nil || !cofly.Equal(change, map[string]any{"a": 2}) {
+		t.Fatalf("Difference: unexpected %#v, %v", change, err)
+	}
+}
+
+func TestLimitsMergeResources(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits cofly.Limits
+		target any
+		change any
+	}{
+		{
+			name:   "splices",
+			limits: cofly.Limits{MaxSplices: 2},
+			target: []any{1, 2, 3, 4},
+			change: map[string]any{"0..1": []any{}, "1..2": []any{}, "2..3": []any{}},
+		},
+		{
+			name:   "splices-in-nested-arrays",
+			limits: cofly.Limits{MaxSplices: 1},
+			target: map[string]any{"a": []any{1}, "b": []any{2}},
+			change: map[string]any{"a": map[string]any{"0..": []any{}}, "b": map[string]any{"0..": []any{}}},
+		},
+		{
+			name:   "string-splices",
+			limits: cofly.Limits{MaxSplices: 1},
+			target: "abcd",
+			change: map[string]any{"0..1": "x", "2..3": "y"},
+		},
+		{
+			name:   "splice-elements",
+			limits: cofly.Limits{MaxSpliceElements: 3},
+			target: []any{},
+			change: map[string]any{"0..": []any{1, 2, 3, 4}},
+		},
+		{
+			name:   "object-keys",
+			limits: cofly.Limits{MaxObjectKeys: 2},
+			target: map[string]any{"a": map[string]any{}},
+			change: map[string]any{"a": map[string]any{"x": 1, "y": 2}},
+		},
+		{
+			name:   "array-length",
+			limits: cofly.Limits{MaxArrayLength: 3},
+			target: []any{1, 2},
+			change: cofly.Splices{{From: 2, To: 2, Values: []any{3, 4}}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := testCase.limits.Merge(testCase.target, testCase.change, true)
+			if !errors.Is(err, cofly.ErrSizeLimit) {
+				t.Fatalf("expected ErrSizeLimit, got %v", err)
+			}
+			if errors.Is(err, cofly.ErrInvalidChange) {
+				t.Fatalf("limit error must not be an invalid change: %v", err)
+			}
+		})
+	}
+
+	t.Run("within-limits", func(t *testing.T) {
+		limits := cofly.Limits{MaxSplices: 1, MaxSpliceElements: 2, MaxObjectKeys: 2, MaxArrayLength: 3}
+		target := map[string]any{"a": []any{1, 2}}
+
+		output, err := limits.Merge(target, map[string]any{"a": map[string]any{"1..2": []any{3, 4}}}, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !cofly.Equal(output, map[string]any{"a": []any{1, 3, 4}}) {
+			t.Fatalf("unexpected output %#v", output)
+		}
+	})
+}
+
+func TestLimitsApplyAll(t *testing.T) {
+	limits := cofly.Limits{MaxArrayLength: 3}
+	var target any = map[string]any{"a": []any{1}, "b": 1}
+
+	err := limits.ApplyAll(&target, []any{
+		map[string]any{"b": 2},
+		map[string]any{"a": map[string]any{"1..": []any{2, 3, 4}}},
+	}, true)
+	if !errors.Is(err, cofly.ErrSizeLimit) {
+		t.Fatalf("expected ErrSizeLimit, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "change 1: ") {
+		t.Fatalf("expected error to name the change, got %v", err)
+	}
+	if !cofly.Equal(target, map[string]any{"a": []any{1}, "b": 1}) {
+		t.Fatalf("target changed: %#v", target)
+	}
+
+	cyclic := map[string]any{}
+	cyclic["self"] = cyclic
+
+	if err := limits.ApplyAll(&target, []any{cyclic}, true); !errors.Is(err, cofly.ErrCycle) {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+}
@@ -1,10 +1,55 @@
 package cofly
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrInvalidChange is returned (wrapped) when a change cannot be merged into its target.
+var ErrInvalidChange = errors.New("invalid change")
+
 func Merge(target any, change any, doClean bool) any {
+	return (&merger{doClean: doClean}).merge(target, change)
+}
+
+// merger holds the state of a single Merge call.
+type merger struct {
+	doClean bool
+	limits  Limits
+
+	// isComposing makes the target a change rather than a value (see Compose).
+	isComposing bool
+
+	splicesCount  int
+	elementsCount int
+	keysCount     int
+}
+
+func (m *merger) merge(target any, change any) any {
+	// A Differ is changed by object changes, and replaced by anything else (see differDifference).
+	if differ, ok := asDiffer(target); ok {
+		if changeMap, ok := change.(map[string]any); ok && changeMap != nil {
+			return differ.CoflyMerge(changeMap)
+		}
+
+		if change == Undefined {
+			return target
+		}
+
+		return change
+	}
+
+	target, change = normalize(target), normalize(change)
+
+	if _, ok := target.([]any); ok && m.isComposing {
+		if changeMap, ok := change.(map[string]any); ok && changeMap != nil && !isOperationMap(changeMap) {
+			panic(newNotComposableError(target))
+		}
+
+		// Arrays in the first change are values that the second one changes.
+		return m.mergeValue(target, change)
+	}
+
 	switch change := change.(type) {
 	case nil,
 		bool,
@@ -23,9 +68,47 @@ func Merge(target any, change any, doClean bool) any {
 			return nil
 		}
 
+		// Outside Compose, an object target is data, so a change with an "$inc", "$add" or "$remove" key
+		// is merged into it key by key.
+		if delta, ok := parseIncrement(change); ok && (m.isComposing || !isObject(target)) {
+			return mergeIncrement(target, delta, m.isComposing)
+		}
+
+		if setChange, ok := parseSetChange(change); ok && (m.isComposing || !isObject(target)) {
+			return mergeSetChange(target, setChange, m.isComposing)
+		}
+
+		if changeSplices := parseStringSplices(change); len(changeSplices) > 0 {
+			m.countSplices(len(changeSplices), 0)
+
+			switch target := target.(type) {
+			case string:
+				if !m.isComposing || target != Undefined {
+					return mergeStringSplicesIntoString(target, changeSplices)
+				}
+
+				panic("target is deleted")
+			case map[string]any:
+				if !m.isComposing {
+					// Keys of an object can look like spans.
+					break
+				}
+
+				if targetSplices := parseStringSplices(target); len(targetSplices) > 0 {
+					return mergeStringSplicesIntoStringSplices(targetSplices, changeSplices)
+				}
+
+				panic("target is not string splices")
+			}
+
+			// For other targets the map is an object that replaces them.
+		}
+
 		changeSplices := parseSplices(change)
 
 		if len(changeSplices) > 0 {
+			m.countArraySplices(changeSplices)
+
 			switch target := target.(type) {
 			case map[string]any:
 				targetSplices := parseSplices(target)
@@ -34,9 +117,11 @@ func Merge(target any, change any, doClean bool) any {
 					panic("target is not splices")
 				}
 
-				return mergeSplicesIntoSplices(targetSplices, changeSplices, doClean)
+				return splicesToMap(m.mergeSplicesIntoSplices(targetSplices, changeSplices))
+			case Splices:
+				return splicesToSplices(m.mergeSplicesIntoSplices(target.parse(), changeSplices))
 			case []any:
-				return mergeSplicesIntoArray(target, changeSplices, doClean)
+				return m.mergeSplicesIntoArray(target, changeSplices)
 			default:
 				panic(fmt.Sprintf("target type [%T] is not supported", target))
 			}
@@ -44,7 +129,18 @@ func Merge(target any, change any, doClean bool) any {
 
 		switch target := target.(type) {
 		case map[string]any:
-			return mergeMapIntoMap(target, change, doClean)
+			if m.isComposing && isOperationMap(target) {
+				// The first change makes the value a number, an array or a string, which the object replaces.
+				return change
+			}
+
+			return m.mergeMapIntoMap(target, change)
+		case Splices:
+			if m.isComposing {
+				return change
+			}
+
+			panic(fmt.Sprintf("target type [%T] is not supported", target))
 		case nil,
 			bool,
 			int, int8, int16, int32, int64,
@@ -52,7 +148,43 @@ func Merge(target any, change any, doClean bool) any {
 			float32, float64,
 			string,
 			[]any:
+			if m.isComposing {
+				panic(newNotComposableError(target))
+			}
+
 			return change
+		default:
+			if isLeaf(target) {
+				if m.isComposing {
+					panic(newNotComposableError(target))
+				}
+
+				return change
+			}
+
+			panic(fmt.Sprintf("target type [%T] is not supported", target))
+		}
+	case Splices:
+		if change == nil {
+			return nil
+		}
+
+		changeSplices := change.parse()
+		m.countArraySplices(changeSplices)
+
+		switch target := target.(type) {
+		case []any:
+			return m.mergeSplicesIntoArray(target, changeSplices)
+		case Splices:
+			return splicesToSplices(m.mergeSplicesIntoSplices(target.parse(), changeSplices))
+		case map[string]any:
+			targetSplices := parseSplices(target)
+
+			if len(targetSplices) == 0 {
+				panic("target is not splices")
+			}
+
+			return splicesToMap(m.mergeSplicesIntoSplices(targetSplices, changeSplices))
 		default:
 			panic(fmt.Sprintf("target type [%T] is not supported", target))
 		}
@@ -65,17 +197,109 @@ func Merge(target any, change any, doClean bool) any {
 		case nil, bool, int, float64, string, map[string]any, []any:
 			return change
 		default:
+			if isLeaf(target) {
+				return change
+			}
+
 			panic(fmt.Sprintf("target type [%T] is not supported", target))
 		}
 	default:
+		if _, ok := asDiffer(change); ok || isLeaf(change) {
+			return change
+		}
+
 		panic(fmt.Sprintf("change type [%T] is not supported", change))
 	}
 }
 
-func mergeMapIntoMap(targetMap map[string]any, changeMap map[string]any, doClean bool) map[string]any {
+// isOperationMap reports whether a map is a change operation rather than an object.
+func isOperationMap(value map[string]any) bool {
+	if _, ok := parseIncrement(value); ok {
+		return true
+	}
+
+	if _, ok := parseSetChange(value); ok {
+		return true
+	}
+
+	return len(parseStringSplices(value)) > 0 || len(parseSplices(value)) > 0
+}
+
+func tryMerge(target any, change any, doClean bool) (output any, err error) {
+	return (&merger{doClean: doClean}).tryMerge(target, change)
+}
+
+// mergeError is panicked with errors that tryMerge returns as they are.
+type mergeError struct {
+	error
+}
+
+func (m *merger) tryMerge(target any, change any) (output any, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if mergeError, ok := recovered.(mergeError); ok {
+				err = mergeError.error
+				return
+			}
+
+			err = fmt.Errorf("%w: %v", ErrInvalidChange, recovered)
+		}
+	}()
+
+	return m.merge(target, change), nil
+}
+
+// countSplices accounts for splices and their payload elements before they are merged.
+func (m *merger) countSplices(splicesCount, elementsCount int) {
+	m.splicesCount += splicesCount
+	m.elementsCount += elementsCount
+
+	if m.limits.MaxSplices > 0 && m.splicesCount > m.limits.MaxSplices {
+		panic(mergeError{fmt.Errorf("%w: more than %d splices", ErrSizeLimit, m.limits.MaxSplices)})
+	}
+
+	if m.limits.MaxSpliceElements > 0 && m.elementsCount > m.limits.MaxSpliceElements {
+		panic(mergeError{fmt.Errorf("%w: more than %d splice elements", ErrSizeLimit, m.limits.MaxSpliceElements)})
+	}
+}
+
+func (m *merger) countArraySplices(splices []splice) {
+	elementsCount := 0
+
+	for _, splice := range splices {
+		elementsCount += len(splice.value)
+	}
+
+	m.countSplices(len(splices), elementsCount)
+}
+
+// mergeValue merges a change into a value while composing, like Merge with doClean.
+func (m *merger) mergeValue(target any, change any) any {
+	isComposing, doClean := m.isComposing, m.doClean
+	m.isComposing, m.doClean = false, true
+
+	defer func() {
+		m.isComposing, m.doClean = isComposing, doClean
+	}()
+
+	return m.merge(target, change)
+}
+
+func isObject(value any) bool {
+	_, ok := value.(map[string]any)
+	return ok
+}
+
+func (m *merger) mergeMapIntoMap(targetMap map[string]any, changeMap map[string]any) map[string]any {
+	m.keysCount += len(changeMap)
+
+	if m.limits.MaxObjectKeys > 0 && m.keysCount > m.limits.MaxObjectKeys {
+		panic(mergeError{fmt.Errorf("%w: more than %d object keys", ErrSizeLimit, m.limits.MaxObjectKeys)})
+	}
+
 	for changeKey, changeValue := range changeMap {
 		if changeValue == Undefined {
-			if doClean {
+			if m.doClean {
 				delete(targetMap, changeKey)
 				continue
 			}
@@ -86,7 +310,7 @@ func mergeMapIntoMap(targetMap map[string]any, changeMap map[string]any, doClean
 
 		targetValue, doesTargetValueExist := targetMap[changeKey]
 		if doesTargetValueExist {
-			targetMap[changeKey] = Merge(targetValue, changeValue, doClean)
+			targetMap[changeKey] = m.merge(targetValue, changeValue)
 		} else {
 			targetMap[changeKey] = changeValue
 		}
@@ -95,7 +319,7 @@ func mergeMapIntoMap(targetMap map[string]any, changeMap map[string]any, doClean
 	return targetMap
 }
 
-func mergeSplicesIntoArray(targetArray []any, changeSplices []splice, doClean bool) []any {
+func (m *merger) mergeSplicesIntoArray(targetArray []any, changeSplices []splice) []any {
 	sortSplices(changeSplices)
 	validateSplices(changeSplices)
 
@@ -111,6 +335,10 @@ func mergeSplicesIntoArray(targetArray []any, changeSplices []splice, doClean bo
 		outputArrayLength += len(changeSplice.value) - changeSplice.span.length()
 	}
 
+	if m.limits.MaxArrayLength > 0 && outputArrayLength > m.limits.MaxArrayLength {
+		panic(mergeError{fmt.Errorf("%w: array of %d elements is longer than %d", ErrSizeLimit, outputArrayLength, m.limits.MaxArrayLength)})
+	}
+
 	// fmt.Printf("outputArrayLength: %d\n", outputArrayLength)
 	outputArray := make([]any, 0, outputArrayLength)
 	targetArrayCursor := 0
@@ -128,10 +356,9 @@ func mergeSplicesIntoArray(targetArray []any, changeSplices []splice, doClean bo
 		// fmt.Printf("modifiedElementsCount: %d\n", modifiedElementsCount)
 
 		for elementIndex := range modifiedElementsCount {
-			outputArray = append(outputArray, Merge(
+			outputArray = append(outputArray, m.merge(
 				targetArray[changeSplice.span.indexFrom+elementIndex],
 				changeSplice.value[changeSpliceValueOffset+elementIndex],
-				doClean,
 			))
 		}
 
@@ -158,11 +385,3 @@ func mergeSplicesIntoArray(targetArray []any, changeSplices []splice, doClean bo
 
 	return outputArray
 }
-
-func mergeSplicesIntoSplices(
-	targetSplices []splice,
-	changeSplices []splice,
-	doClean bool,
-) any {
-	panic("not implemented")
-}
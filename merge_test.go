@@ -322,3 +322,47 @@ func TestMerge(t *testing.T) {
 		}
 	})
 }
+
+func TestMergeSplices(t *testing.T) {
+	t.Run("applies-unsorted-splices", func(t *testing.T) {
+		target := []any{"a", "b", "c", "d"}
+		change := cofly.Splices{
+			{From: 4, To: 4, Values: []any{"e"}},
+			{From: 1, To: 3, Values: []any{}},
+		}
+		want := []any{"a", "d", "e"}
+
+		got := cofly.Merge(target, change, true)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("invalid-splices-panic", func(t *testing.T) {
+		mustPanic(t, func() {
+			_ = cofly.Merge([]any{"a"}, cofly.Splices{{From: 2, To: 1}}, true)
+		})
+		mustPanic(t, func() {
+			_ = cofly.Merge([]any{"a", "b"}, cofly.Splices{{From: 0, To: 2}, {From: 1, To: 2}}, true)
+		})
+		mustPanic(t, func() {
+			_ = cofly.Merge("a", cofly.Splices{{From: 0, To: 0}}, true)
+		})
+	})
+
+	t.Run("nil-splices-set-nil", func(t *testing.T) {
+		if got := cofly.Merge([]any{"a"}, cofly.Splices(nil), true); got != nil {
+			t.Fatalf("expected nil, got %#v", got)
+		}
+	})
+
+	t.Run("clone-is-deep", func(t *testing.T) {
+		change := cofly.Splices{{From: 0, To: 1, Values: []any{map[string]any{"a": 1}}}}
+		cloned := cofly.Clone(change).(cofly.Splices)
+		cloned[0].Values[0].(map[string]any)["a"] = 2
+
+		if change[0].Values[0].(map[string]any)["a"] != 1 {
+			t.Fatalf("clone shares nested values with the original")
+		}
+	})
+}
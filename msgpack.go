@@ -0,0 +1,503 @@
+package cofly
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// msgpackUndefinedType is the extension type used for Undefined (encoded with an empty payload).
+const msgpackUndefinedType = 0
+
+// msgpackTimestampType is the extension type of timestamps defined by the MessagePack spec.
+const msgpackTimestampType = 0xff
+
+// maxDecodingDepth limits the nesting of arrays and maps in binary encodings,
+// so deeply nested input returns an error instead of overflowing the stack.
+const maxDecodingDepth = 10000
+
+var (
+	errMsgpackTruncated = errors.New("invalid msgpack: unexpected end of data")
+	errMsgpackTooDeep   = errors.New("invalid msgpack: nesting is too deep")
+)
+
+func MarshalMsgpack(change any) ([]byte, error) {
+	return appendMsgpack(nil, change)
+}
+
+func UnmarshalMsgpack(data []byte) (any, error) {
+	decoder := msgpackDecoder{data: data}
+
+	value, err := decoder.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.offset != len(data) {
+		return nil, errors.New("invalid msgpack: unexpected data after top-level value")
+	}
+
+	return value, nil
+}
+
+func appendMsgpack(buffer []byte, value any) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(buffer, 0xc0), nil
+	case bool:
+		if value {
+			return append(buffer, 0xc3), nil
+		}
+
+		return append(buffer, 0xc2), nil
+	case int, int8, int16, int32, int64:
+		return appendMsgpackInt(buffer, toInt64(value)), nil
+	case uint, uint8, uint16, uint32, uint64:
+		return appendMsgpackUint(buffer, toUint64(value)), nil
+	case float32:
+		buffer = append(buffer, 0xca)
+		return binary.BigEndian.AppendUint32(buffer, math.Float32bits(value)), nil
+	case float64:
+		buffer = append(buffer, 0xcb)
+		return binary.BigEndian.AppendUint64(buffer, math.Float64bits(value)), nil
+	case string:
+		if value == Undefined {
+			return append(buffer, 0xc7, 0x00, msgpackUndefinedType), nil
+		}
+
+		return appendMsgpackString(buffer, value), nil
+	case []byte:
+		if value == nil {
+			return append(buffer, 0xc0), nil
+		}
+
+		switch length := len(value); {
+		case length <= math.MaxUint8:
+			buffer = append(buffer, 0xc4, byte(length))
+		case length <= math.MaxUint16:
+			buffer = binary.BigEndian.AppendUint16(append(buffer, 0xc5), uint16(length))
+		default:
+			buffer = binary.BigEndian.AppendUint32(append(buffer, 0xc6), uint32(length))
+		}
+
+		return append(buffer, value...), nil
+	case time.Time:
+		// The 96-bit timestamp format covers every time.Time.
+		buffer = append(buffer, 0xc7, 12, msgpackTimestampType)
+		buffer = binary.BigEndian.AppendUint32(buffer, uint32(value.Nanosecond()))
+		return binary.BigEndian.AppendUint64(buffer, uint64(value.Unix())), nil
+	case map[string]any:
+		if value == nil {
+			return append(buffer, 0xc0), nil
+		}
+
+		buffer = appendMsgpackHeader(buffer, len(value), 0x80, 0xde)
+
+		if splices := parseSplices(value); len(splices) > 0 {
+			sortSplices(splices)
+
+			for _, splice := range splices {
+				buffer = append(buffer, 0x92)
+				buffer = appendMsgpackInt(buffer, int64(splice.span.indexFrom))
+				buffer = appendMsgpackInt(buffer, int64(splice.span.indexTo))
+
+				var err error
+				buffer, err = appendMsgpack(buffer, splice.value)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return buffer, nil
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			buffer = appendMsgpackString(buffer, key)
+
+			var err error
+			buffer, err = appendMsgpack(buffer, value[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return buffer, nil
+	case []any:
+		if value == nil {
+			return append(buffer, 0xc0), nil
+		}
+
+		buffer = appendMsgpackHeader(buffer, len(value), 0x90, 0xdc)
+
+		for _, element := range value {
+			var err error
+			buffer, err = appendMsgpack(buffer, element)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return buffer, nil
+	case Splices:
+		if value == nil {
+			return appendMsgpack(buffer, nil)
+		}
+
+		return appendMsgpack(buffer, value.Map())
+	default:
+		if value, ok := normalizeCollection(value); ok {
+			return appendMsgpack(buffer, value)
+		}
+
+		if isLeaf(value) {
+			value, err := leafValue(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return appendMsgpack(buffer, value)
+		}
+
+		return nil, fmt.Errorf("type [%T] unsupported", value)
+	}
+}
+
+func appendMsgpackInt(buffer []byte, value int64) []byte {
+	switch {
+	case value >= 0:
+		return appendMsgpackUint(buffer, uint64(value))
+	case value >= -32:
+		return append(buffer, byte(value))
+	case value >= math.MinInt8:
+		return append(buffer, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buffer, 0xd3), uint64(value))
+	}
+}
+
+func appendMsgpackUint(buffer []byte, value uint64) []byte {
+	switch {
+	case value <= 0x7f:
+		return append(buffer, byte(value))
+	case value <= math.MaxUint8:
+		return append(buffer, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xcd), uint16(value))
+	case value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xce), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(buffer, 0xcf), value)
+	}
+}
+
+func appendMsgpackString(buffer []byte, value string) []byte {
+	switch length := len(value); {
+	case length < 32:
+		buffer = append(buffer, 0xa0|byte(length))
+	case length <= math.MaxUint8:
+		buffer = append(buffer, 0xd9, byte(length))
+	case length <= math.MaxUint16:
+		buffer = binary.BigEndian.AppendUint16(append(buffer, 0xda), uint16(length))
+	default:
+		buffer = binary.BigEndian.AppendUint32(append(buffer, 0xdb), uint32(length))
+	}
+
+	return append(buffer, value...)
+}
+
+// appendMsgpackHeader writes an array or map header: fixType for short collections,
+// followed by the 16-bit and 32-bit variants (type16, type16+1).
+func appendMsgpackHeader(buffer []byte, length int, fixType, type16 byte) []byte {
+	switch {
+	case length < 16:
+		return append(buffer, fixType|byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, type16), uint16(length))
+	default:
+		return binary.BigEndian.AppendUint32(append(buffer, type16+1), uint32(length))
+	}
+}
+
+type msgpackDecoder struct {
+	data   []byte
+	offset int
+	depth  int
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.offset < n {
+		return nil, errMsgpackTruncated
+	}
+
+	bytes := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return bytes, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	bytes, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(bytes[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(bytes)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(bytes)), nil
+	default:
+		return binary.BigEndian.Uint64(bytes), nil
+	}
+}
+
+func (d *msgpackDecoder) readLength(size int) (int, error) {
+	length, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if length > uint64(len(d.data)-d.offset) {
+		return 0, errMsgpackTruncated
+	}
+
+	return int(length), nil
+}
+
+func (d *msgpackDecoder) decodeValue() (any, error) {
+	prefix, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b := prefix[0]; {
+	case b <= 0x7f:
+		return int(b), nil
+	case b >= 0xe0:
+		return int(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.decodeArray(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.decodeString(int(b & 0x1f))
+	}
+
+	switch b := prefix[0]; b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := d.readUint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+
+		if value > math.MaxInt64 {
+			return value, nil
+		}
+
+		return int(value), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+
+		value, err := d.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		// Sign-extend from the encoded width.
+		shift := 64 - 8*size
+		return int(int64(value<<shift) >> shift), nil
+	case 0xca:
+		value, err := d.readUint(4)
+		if err != nil {
+			return nil, err
+		}
+
+		return math.Float32frombits(uint32(value)), nil
+	case 0xcb:
+		value, err := d.readUint(8)
+		if err != nil {
+			return nil, err
+		}
+
+		return math.Float64frombits(value), nil
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.readLength(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeString(length)
+	case 0xdc, 0xdd:
+		length, err := d.readLength(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeArray(length)
+	case 0xde, 0xdf:
+		length, err := d.readLength(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeMap(length)
+	case 0xc4, 0xc5, 0xc6:
+		length, err := d.readLength(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		bytes, err := d.read(length)
+		if err != nil {
+			return nil, err
+		}
+
+		return slices.Clone(bytes), nil
+	case 0xc7:
+		header, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+
+		if header[0] == 0 && header[1] == msgpackUndefinedType {
+			return Undefined, nil
+		}
+
+		if header[0] == 12 && header[1] == msgpackTimestampType {
+			return d.decodeTimestamp(12)
+		}
+
+		return nil, fmt.Errorf("invalid msgpack: unsupported extension type %d", int8(header[1]))
+	case 0xd6, 0xd7:
+		header, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if header[0] != msgpackTimestampType {
+			return nil, fmt.Errorf("invalid msgpack: unsupported extension type %d", int8(header[0]))
+		}
+
+		return d.decodeTimestamp(4 << (b - 0xd6))
+	default:
+		return nil, fmt.Errorf("invalid msgpack: unsupported format 0x%02x", b)
+	}
+}
+
+// decodeTimestamp reads the 32-, 64- or 96-bit payload of a timestamp extension.
+func (d *msgpackDecoder) decodeTimestamp(size int) (any, error) {
+	payload, err := d.read(size)
+	if err != nil {
+		return nil, err
+	}
+
+	switch size {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(payload)), 0), nil
+	case 8:
+		value := binary.BigEndian.Uint64(payload)
+		return time.Unix(int64(value&(1<<34-1)), int64(value>>34)), nil
+	default:
+		nanoseconds := binary.BigEndian.Uint32(payload)
+		return time.Unix(int64(binary.BigEndian.Uint64(payload[4:])), int64(nanoseconds)), nil
+	}
+}
+
+func (d *msgpackDecoder) decodeString(length int) (any, error) {
+	bytes, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(bytes), nil
+}
+
+func (d *msgpackDecoder) decodeArray(length int) (any, error) {
+	if d.depth++; d.depth > maxDecodingDepth {
+		return nil, errMsgpackTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	array := make([]any, 0, min(length, len(d.data)-d.offset))
+
+	for range length {
+		element, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, element)
+	}
+
+	return array, nil
+}
+
+func (d *msgpackDecoder) decodeMap(length int) (any, error) {
+	if d.depth++; d.depth > maxDecodingDepth {
+		return nil, errMsgpackTooDeep
+	}
+	defer func() { d.depth-- }()
+
+	object := make(map[string]any, min(length, len(d.data)-d.offset))
+
+	for range length {
+		key, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		keyString, err := decodeBinaryKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		object[keyString] = value
+	}
+
+	return object, nil
+}
+
+// decodeBinaryKey converts a decoded map key back to its string form.
+// Binary encodings write span keys as [from, to] integer pairs.
+func decodeBinaryKey(key any) (string, error) {
+	switch key := key.(type) {
+	case string:
+		return key, nil
+	case []any:
+		if len(key) == 2 {
+			indexFrom, isIndexFromInt := key[0].(int)
+			indexTo, isIndexToInt := key[1].(int)
+
+			if isIndexFromInt && isIndexToInt && 0 <= indexFrom && indexFrom <= indexTo {
+				return newSpan(indexFrom, indexTo).string(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("invalid map key %#v", key)
+}
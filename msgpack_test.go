@@ -0,0 +1,107 @@
+package cofly_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestMsgpack(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		change := map[string]any{
+			"nil":    nil,
+			"bools":  []any{true, false},
+			"ints":   []any{0, 127, 128, -1, -32, -33, -129, 70000, -70000, 1 << 40, -(1 << 40)},
+			"uint":   uint64(1 << 63),
+			"f32":    float32(1.5),
+			"f64":    2.25,
+			"long":   strings.Repeat("x", 300),
+			"gone":   cofly.Undefined,
+			"list":   map[string]any{"1..2": []any{"B"}, "3..": []any{}, "10..12": []any{map[string]any{"a": 1}}},
+			"nested": map[string]any{"1..2": "not-a-splice"},
+		}
+
+		data, err := cofly.MarshalMsgpack(change)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := cofly.UnmarshalMsgpack(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, change) {
+			t.Fatalf("expected %#v, got %#v", change, got)
+		}
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			change any
+			want   []byte
+		}{
+			{"undefined", cofly.Undefined, []byte{0xc7, 0x00, 0x00}},
+			{"fixint", 5, []byte{0x05}},
+			{"negative-fixint", -1, []byte{0xff}},
+			{"fixstr", "ab", []byte{0xa2, 'a', 'b'}},
+			{"span-keys-as-pairs", map[string]any{"3..": []any{1}, "1..2": []any{}}, []byte{
+				0x82,
+				0x92, 0x01, 0x02, 0x90,
+				0x92, 0x03, 0x03, 0x91, 0x01,
+			}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				got, err := cofly.MarshalMsgpack(tc.change)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !bytes.Equal(got, tc.want) {
+					t.Fatalf("expected % x, got % x", tc.want, got)
+				}
+			})
+		}
+	})
+
+	t.Run("invalid-input-errors", func(t *testing.T) {
+		for _, data := range [][]byte{
+			{},
+			{0x92, 0x01},
+			{0xa3, 'a'},
+			{0x81, 0x01, 0x01},
+			{0xc7, 0x00, 0x05},
+			{0x01, 0x02},
+			{0xdd, 0xff, 0xff, 0xff, 0xff},
+		} {
+			if _, err := cofly.UnmarshalMsgpack(data); err == nil {
+				t.Fatalf("expected error for % x", data)
+			}
+		}
+	})
+
+	t.Run("deep-nesting-errors", func(t *testing.T) {
+		for _, prefix := range [][]byte{{0x91}, {0x81, 0xa1, 'a'}} {
+			data := append(bytes.Repeat(prefix, 1<<20), 0x01)
+			if _, err := cofly.UnmarshalMsgpack(data); err == nil {
+				t.Fatalf("expected error for nested % x", prefix)
+			}
+
+			data = append(bytes.Repeat(prefix, 1000), 0x01)
+			if _, err := cofly.UnmarshalMsgpack(data); err != nil {
+				t.Fatalf("unexpected error for nested % x: %v", prefix, err)
+			}
+		}
+	})
+
+	t.Run("unsupported-types-error", func(t *testing.T) {
+		type S struct{ A int }
+		if _, err := cofly.MarshalMsgpack([]any{S{A: 1}}); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
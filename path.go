@@ -0,0 +1,54 @@
+package cofly
+
+import (
+	"fmt"
+	"strings"
+)
+
+var pathEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+var pathUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePath splits a JSON Pointer (RFC 6901) such as "/rooms/*/players" into unescaped segments.
+func parsePath(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+
+	if path[0] != '/' {
+		return nil, fmt.Errorf("invalid path %q: must be empty or start with \"/\"", path)
+	}
+
+	segments := strings.Split(path[1:], "/")
+
+	for index, segment := range segments {
+		segments[index] = pathUnescaper.Replace(segment)
+	}
+
+	return segments, nil
+}
+
+func formatPath(segments []string) string {
+	var builder strings.Builder
+
+	for _, segment := range segments {
+		builder.WriteByte('/')
+		builder.WriteString(pathEscaper.Replace(segment))
+	}
+
+	return builder.String()
+}
+
+// matchPath reports whether path matches pattern segment by segment; "*" matches any segment.
+func matchPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+
+	for index, segment := range pattern {
+		if segment != "*" && segment != path[index] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,108 @@
+package cofly
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrVersionGap       = errors.New("version gap")
+	ErrDuplicateVersion = errors.New("duplicate version")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrReplicaNotSynced = errors.New("replica is not synced")
+)
+
+// Replica follows a remote document from a stream of snapshots and versioned changes.
+// A gap in the versions, an invalid change or a checksum mismatch leave the replica
+// unsynced until the next snapshot. It is not safe for concurrent use.
+type Replica struct {
+	value    any
+	version  uint64
+	isSynced bool
+}
+
+func NewReplica() *Replica {
+	return &Replica{}
+}
+
+// Value returns a copy of the value.
+func (r *Replica) Value() any {
+	return Clone(r.value)
+}
+
+func (r *Replica) Version() uint64 {
+	return r.version
+}
+
+// IsSynced reports whether the replica holds a verified value.
+func (r *Replica) IsSynced() bool {
+	return r.isSynced
+}
+
+// Apply applies a snapshot (update.Change is the whole value at update.Version) or a change.
+// A non-empty checksum is compared with the Checksum of the resulting value.
+// Changes the replica has already applied return ErrDuplicateVersion and are ignored.
+func (r *Replica) Apply(isSnapshot bool, update VersionedChange, checksum string) error {
+	change, err := tryClone(update.Change)
+	if err != nil {
+		r.isSynced = false
+		return err
+	}
+
+	if isSnapshot {
+		value := change
+
+		if err := verifyChecksum(value, update.Version, checksum); err != nil {
+			r.isSynced = false
+			return err
+		}
+
+		r.value, r.version, r.isSynced = value, update.Version, true
+		return nil
+	}
+
+	if !r.isSynced {
+		return ErrReplicaNotSynced
+	}
+
+	if update.Version <= r.version {
+		return fmt.Errorf("%w: %d", ErrDuplicateVersion, update.Version)
+	}
+
+	if update.PreviousVersion != r.version {
+		r.isSynced = false
+		return fmt.Errorf("%w: expected a change from %d, got one from %d", ErrVersionGap, r.version, update.PreviousVersion)
+	}
+
+	value, err := tryMerge(Clone(r.value), change, true)
+	if err != nil {
+		r.isSynced = false
+		return err
+	}
+
+	if err := verifyChecksum(value, update.Version, checksum); err != nil {
+		r.isSynced = false
+		return err
+	}
+
+	r.value, r.version = value, update.Version
+	return nil
+}
+
+// verifyChecksum compares a non-empty checksum with the Checksum of the value.
+func verifyChecksum(value any, version uint64, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+
+	valueChecksum, err := TryChecksum(value)
+	if err != nil {
+		return fmt.Errorf("%w at version %d", err, version)
+	}
+
+	if valueChecksum != checksum {
+		return fmt.Errorf("%w at version %d", ErrChecksumMismatch, version)
+	}
+
+	return nil
+}
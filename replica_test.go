@@ -0,0 +1,141 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestReplica(t *testing.T) {
+	snapshot := map[string]any{"count": 1, "list": []any{"a"}}
+	change := map[string]any{"count": cofly.Increment(1)}
+	next := map[string]any{"count": 2, "list": []any{"a"}}
+
+	newReplica := func(t *testing.T) *cofly.Replica {
+		t.Helper()
+
+		replica := cofly.NewReplica()
+		if err := replica.Apply(true, cofly.VersionedChange{Version: 3, Change: snapshot}, cofly.Checksum(snapshot)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return replica
+	}
+
+	t.Run("applies-changes", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{PreviousVersion: 3, Version: 4, Change: change}, cofly.Checksum(next))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if replica.Version() != 4 || !replica.IsSynced() || !reflect.DeepEqual(replica.Value(), next) {
+			t.Fatalf("unexpected state: version %d, value %#v", replica.Version(), replica.Value())
+		}
+	})
+
+	t.Run("not-synced-before-snapshot", func(t *testing.T) {
+		err := cofly.NewReplica().Apply(false, cofly.VersionedChange{PreviousVersion: 0, Version: 1, Change: change}, "")
+		if !errors.Is(err, cofly.ErrReplicaNotSynced) {
+			t.Fatalf("expected ErrReplicaNotSynced, got %v", err)
+		}
+	})
+
+	t.Run("duplicate-is-ignored", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{PreviousVersion: 2, Version: 3, Change: change}, "")
+		if !errors.Is(err, cofly.ErrDuplicateVersion) {
+			t.Fatalf("expected ErrDuplicateVersion, got %v", err)
+		}
+		if !replica.IsSynced() || !reflect.DeepEqual(replica.Value(), snapshot) {
+			t.Fatalf("replica changed: %#v", replica.Value())
+		}
+	})
+
+	t.Run("gap-requires-snapshot", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{PreviousVersion: 4, Version: 5, Change: change}, "")
+		if !errors.Is(err, cofly.ErrVersionGap) {
+			t.Fatalf("expected ErrVersionGap, got %v", err)
+		}
+		if replica.IsSynced() {
+			t.Fatalf("expected replica to be unsynced")
+		}
+
+		err = replica.Apply(false, cofly.VersionedChange{PreviousVersion: 3, Version: 4, Change: change}, "")
+		if !errors.Is(err, cofly.ErrReplicaNotSynced) {
+			t.Fatalf("expected ErrReplicaNotSynced, got %v", err)
+		}
+
+		if err := replica.Apply(true, cofly.VersionedChange{Version: 5, Change: next}, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !replica.IsSynced() || replica.Version() != 5 {
+			t.Fatalf("expected replica to be synced at 5, got %d", replica.Version())
+		}
+	})
+
+	t.Run("checksum-mismatch", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{PreviousVersion: 3, Version: 4, Change: change}, cofly.Checksum(snapshot))
+		if !errors.Is(err, cofly.ErrChecksumMismatch) {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+		if replica.IsSynced() || replica.Version() != 3 {
+			t.Fatalf("unexpected state: synced %v, version %d", replica.IsSynced(), replica.Version())
+		}
+	})
+
+	t.Run("invalid-change", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{
+			PreviousVersion: 3,
+			Version:         4,
+			Change:          map[string]any{"list": map[string]any{"5..": []any{"x"}}},
+		}, "")
+		if !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+	})
+
+	t.Run("unhashable-value", func(t *testing.T) {
+		replica := newReplica(t)
+
+		err := replica.Apply(false, cofly.VersionedChange{
+			PreviousVersion: 3,
+			Version:         4,
+			Change:          map[string]any{"hits": counter{value: 1}},
+		}, cofly.Checksum(snapshot))
+		if !errors.Is(err, cofly.ErrUnhashable) {
+			t.Fatalf("expected ErrUnhashable, got %v", err)
+		}
+		if replica.IsSynced() {
+			t.Fatalf("expected replica to be unsynced")
+		}
+	})
+}
+
+func TestChecksum(t *testing.T) {
+	a := map[string]any{"a": 1, "b": []any{1.0, "x"}}
+	b := map[string]any{"b": []any{1, "x"}, "a": 1.0}
+
+	if cofly.Checksum(a) != cofly.Checksum(b) {
+		t.Fatalf("expected equal values to have equal checksums")
+	}
+	if cofly.Checksum(a) == cofly.Checksum(map[string]any{"a": 2, "b": []any{1, "x"}}) {
+		t.Fatalf("expected different values to have different checksums")
+	}
+
+	if checksum, err := cofly.TryChecksum(a); err != nil || checksum != cofly.Checksum(a) {
+		t.Fatalf("expected %q, got %q (%v)", cofly.Checksum(a), checksum, err)
+	}
+	if _, err := cofly.TryChecksum(map[string]any{"hits": counter{value: 1}}); !errors.Is(err, cofly.ErrUnhashable) {
+		t.Fatalf("expected ErrUnhashable, got %v", err)
+	}
+}
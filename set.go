@@ -0,0 +1,131 @@
+package cofly
+
+import "fmt"
+
+const (
+	SetAddKey    = "$add"
+	SetRemoveKey = "$remove"
+)
+
+type setChange struct {
+	add    []any
+	remove []any
+}
+
+func parseSetChange(changeMap map[string]any) (setChange, bool) {
+	if len(changeMap) == 0 {
+		return setChange{}, false
+	}
+
+	var change setChange
+
+	for key, value := range changeMap {
+		values, ok := value.([]any)
+		if !ok {
+			return setChange{}, false
+		}
+
+		switch key {
+		case SetAddKey:
+			change.add = values
+		case SetRemoveKey:
+			change.remove = values
+		default:
+			return setChange{}, false
+		}
+	}
+
+	return change, true
+}
+
+func (change setChange) toMap() map[string]any {
+	changeMap := make(map[string]any, 2)
+
+	// Keep at least one key, an empty map would be an object change.
+	if len(change.add) > 0 || len(change.remove) == 0 {
+		changeMap[SetAddKey] = change.add
+	}
+
+	if len(change.remove) > 0 {
+		changeMap[SetRemoveKey] = change.remove
+	}
+
+	return changeMap
+}
+
+// setDifference compares arrays as sets: positions and duplicates are ignored.
+func setDifference(oldArray, newArray []any) any {
+	change := setChange{
+		add:    setSubtract(newArray, oldArray),
+		remove: setSubtract(oldArray, newArray),
+	}
+
+	if len(change.add) == 0 && len(change.remove) == 0 {
+		return Undefined
+	}
+
+	return change.toMap()
+}
+
+// mergeSetChange applies a set change to an array or nil, and panics on other targets. Removing
+// missing elements and adding present ones are no-ops, so applying the same change twice gives
+// the same result. While composing, a set change merged into another one is composed with it,
+// and a value deleted by the first change counts as nil.
+func mergeSetChange(target any, change setChange, isComposing bool) any {
+	switch target := target.(type) {
+	case nil:
+		return setUnion(nil, change.add)
+	case []any:
+		return setUnion(setSubtract(target, change.remove), change.add)
+	case string:
+		if isComposing && target == Undefined {
+			return setUnion(nil, change.add)
+		}
+	case map[string]any:
+		if targetChange, ok := parseSetChange(target); ok && isComposing {
+			return setChange{
+				add:    setUnion(setSubtract(targetChange.add, change.remove), change.add),
+				remove: setUnion(setSubtract(targetChange.remove, change.add), change.remove),
+			}.toMap()
+		}
+	}
+
+	panic(fmt.Sprintf("set change target type [%T] is not an array", target))
+}
+
+func setContains(values []any, value any) bool {
+	for _, element := range values {
+		if Equal(element, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setSubtract returns the distinct elements of values that are not in removed.
+func setSubtract(values []any, removed []any) []any {
+	output := make([]any, 0, len(values))
+
+	for _, value := range values {
+		if !setContains(removed, value) && !setContains(output, value) {
+			output = append(output, value)
+		}
+	}
+
+	return output
+}
+
+// setUnion returns values followed by the elements of added that are not in values yet.
+func setUnion(values []any, added []any) []any {
+	output := make([]any, len(values), len(values)+len(added))
+	copy(output, values)
+
+	for _, value := range added {
+		if !setContains(output, value) {
+			output = append(output, value)
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,116 @@
+package cofly_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestSetChanges(t *testing.T) {
+	options := cofly.DifferenceOptions{UnorderedPaths: []string{"/tags", "/rooms/*/members"}}
+
+	t.Run("difference-ignores-positions", func(t *testing.T) {
+		oldValue := map[string]any{"tags": []any{"a", "b", "c"}, "list": []any{"a", "b"}}
+		newValue := map[string]any{"tags": []any{"c", "d", "a"}, "list": []any{"b", "a"}}
+
+		change := cofly.DifferenceWithOptions(oldValue, newValue, options).(map[string]any)
+		want := map[string]any{cofly.SetAddKey: []any{"d"}, cofly.SetRemoveKey: []any{"b"}}
+		if !reflect.DeepEqual(change["tags"], want) {
+			t.Fatalf("expected %#v, got %#v", want, change["tags"])
+		}
+		if _, ok := cofly.ParseSplices(change["list"].(map[string]any)); !ok {
+			t.Fatalf("expected ordered splice-map for /list, got %#v", change["list"])
+		}
+
+		got := cofly.Merge(cofly.Clone(oldValue), change, true).(map[string]any)
+		if wantTags := []any{"a", "c", "d"}; !reflect.DeepEqual(got["tags"], wantTags) {
+			t.Fatalf("expected %#v, got %#v", wantTags, got["tags"])
+		}
+	})
+
+	t.Run("reordering-is-no-change", func(t *testing.T) {
+		got := cofly.DifferenceWithOptions(
+			map[string]any{"tags": []any{"a", "b"}},
+			map[string]any{"tags": []any{"b", "a"}},
+			options,
+		)
+		if got != cofly.Undefined {
+			t.Fatalf("expected Undefined, got %#v", got)
+		}
+	})
+
+	t.Run("wildcard-paths", func(t *testing.T) {
+		oldValue := map[string]any{"rooms": map[string]any{"r1": map[string]any{"members": []any{1, 2}}}}
+		newValue := map[string]any{"rooms": map[string]any{"r1": map[string]any{"members": []any{2, 3}}}}
+
+		change := cofly.DifferenceWithOptions(oldValue, newValue, options)
+		want := map[string]any{"rooms": map[string]any{"r1": map[string]any{"members": map[string]any{
+			cofly.SetAddKey:    []any{3},
+			cofly.SetRemoveKey: []any{1},
+		}}}}
+		if !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+	})
+
+	t.Run("concurrent-adds-merge-idempotently", func(t *testing.T) {
+		base := []any{"a"}
+		first := map[string]any{cofly.SetAddKey: []any{"x"}}
+		second := map[string]any{cofly.SetAddKey: []any{"y"}, cofly.SetRemoveKey: []any{"a", "missing"}}
+
+		got := cofly.Merge(cofly.Merge(base, first, true), second, true)
+		got = cofly.Merge(got, first, true)
+		got = cofly.Merge(got, second, true)
+		if want := []any{"x", "y"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("compose", func(t *testing.T) {
+		composed := mustCompose(t,
+			map[string]any{cofly.SetAddKey: []any{"x", "y"}, cofly.SetRemoveKey: []any{"a"}},
+			map[string]any{cofly.SetAddKey: []any{"a"}, cofly.SetRemoveKey: []any{"x"}},
+		)
+		want := map[string]any{cofly.SetAddKey: []any{"y", "a"}, cofly.SetRemoveKey: []any{"x"}}
+		if !reflect.DeepEqual(composed, want) {
+			t.Fatalf("expected %#v, got %#v", want, composed)
+		}
+
+		if got := cofly.Merge(nil, want, true); !reflect.DeepEqual(got, []any{"y", "a"}) {
+			t.Fatalf("unexpected result for nil target: %#v", got)
+		}
+	})
+
+	t.Run("non-array-targets-panic", func(t *testing.T) {
+		for _, target := range []any{"x", 1} {
+			mustPanic(t, func() {
+				_ = cofly.Merge(target, map[string]any{cofly.SetAddKey: []any{"y"}}, true)
+			})
+		}
+	})
+
+	t.Run("objects-with-set-keys-are-data", func(t *testing.T) {
+		for _, pair := range [][2]any{
+			{map[string]any{"a": map[string]any{}}, map[string]any{"a": map[string]any{cofly.SetAddKey: []any{"x"}}}},
+			{
+				map[string]any{"a": map[string]any{cofly.SetAddKey: []any{"x"}}},
+				map[string]any{"a": map[string]any{cofly.SetRemoveKey: []any{"y"}}},
+			},
+			{map[string]any{}, map[string]any{"a": map[string]any{cofly.SetAddKey: []any{"x"}, cofly.SetRemoveKey: []any{}}}},
+		} {
+			oldValue, newValue := pair[0], pair[1]
+
+			change := cofly.Difference(oldValue, newValue)
+			if got := cofly.Merge(cofly.Clone(oldValue), change, true); !reflect.DeepEqual(got, newValue) {
+				t.Fatalf("round-trip from %#v: expected %#v, got %#v", oldValue, newValue, got)
+			}
+		}
+	})
+
+	t.Run("invalid-path-panics", func(t *testing.T) {
+		mustPanic(t, func() {
+			_ = cofly.DifferenceWithOptions(nil, nil, cofly.DifferenceOptions{UnorderedPaths: []string{"tags"}})
+		})
+	})
+}
@@ -0,0 +1,324 @@
+package cofly
+
+import (
+	"sync"
+)
+
+// Backpressure decides what happens when a subscriber does not keep up with the changes.
+type Backpressure int
+
+const (
+	// BackpressureDrop discards updates that do not fit into the subscriber buffer.
+	// Receivers detect the gap by comparing PreviousVersion with the last version they saw.
+	BackpressureDrop Backpressure = iota
+	// BackpressureBlock makes Apply wait until the subscriber receives the update.
+	BackpressureBlock
+	// BackpressureCoalesce composes the updates the subscriber has not received yet into one.
+	BackpressureCoalesce
+)
+
+// SharedDocument is a Document that is safe for concurrent use and notifies subscribers about applied changes.
+type SharedDocument struct {
+	mutex    sync.RWMutex
+	document *Document
+
+	// queue holds the applied updates and the new subscriptions waiting to be published, in version order.
+	queueMutex sync.Mutex
+	queue      []publication
+
+	// publishMutex orders deliveries and guards subscriptions and watchers.
+	publishMutex  sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	watchers      map[*watcher]struct{}
+}
+
+// publication is an applied update to deliver, or a subscription to register.
+type publication struct {
+	update        VersionedChange
+	previousValue any
+	value         any
+	subscription  *Subscription
+}
+
+func NewSharedDocument(value any) *SharedDocument {
+	return &SharedDocument{
+		document:      NewDocument(value),
+		subscriptions: map[*Subscription]struct{}{},
+		watchers:      map[*watcher]struct{}{},
+	}
+}
+
+func (d *SharedDocument) Version() uint64 {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.document.Version()
+}
+
+// Value returns a copy of the current value.
+func (d *SharedDocument) Value() any {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.document.Value()
+}
+
+// Read calls fn with the current value and version without copying the value.
+// fn must not modify the value or keep references to it.
+func (d *SharedDocument) Read(fn func(value any, version uint64)) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	fn(d.document.value, d.document.Version())
+}
+
+func (d *SharedDocument) Snapshot(version uint64) (any, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.document.Snapshot(version)
+}
+
+func (d *SharedDocument) ChangesSince(version uint64) ([]VersionedChange, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.document.ChangesSince(version)
+}
+
+func (d *SharedDocument) Compact(version uint64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.document.Compact(version)
+}
+
+func (d *SharedDocument) Truncate(version uint64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.document.Truncate(version)
+}
+
+// Apply merges the change atomically and delivers it to the subscribers before returning.
+func (d *SharedDocument) Apply(change any) (uint64, error) {
+	d.mutex.Lock()
+
+	previousVersion := d.document.Version()
+	previousValue := d.document.value
+
+	version, err := d.document.Apply(change)
+	if err != nil || version == previousVersion {
+		d.mutex.Unlock()
+		return version, err
+	}
+
+	// Queueing the update before releasing the document keeps deliveries in version order,
+	// and publishing without the document lock keeps slow subscribers from blocking readers.
+	// Document.Apply replaces the value instead of modifying it, so both values stay intact.
+	d.enqueue(publication{
+		update:        d.document.changes[len(d.document.changes)-1],
+		previousValue: previousValue,
+		value:         d.document.value,
+	})
+	d.mutex.Unlock()
+
+	d.publish()
+
+	return version, nil
+}
+
+func (d *SharedDocument) enqueue(publication publication) {
+	d.queueMutex.Lock()
+	d.queue = append(d.queue, publication)
+	d.queueMutex.Unlock()
+}
+
+// publish delivers the queued publications. Whoever holds the publish lock also delivers
+// the publications queued by others, so Apply returns after its update is delivered.
+func (d *SharedDocument) publish() {
+	d.publishMutex.Lock()
+	defer d.publishMutex.Unlock()
+
+	for {
+		d.queueMutex.Lock()
+		if len(d.queue) == 0 {
+			d.queueMutex.Unlock()
+			return
+		}
+
+		next := d.queue[0]
+		d.queue[0] = publication{}
+		d.queue = d.queue[1:]
+		d.queueMutex.Unlock()
+
+		if subscription := next.subscription; subscription != nil {
+			select {
+			case <-subscription.done:
+			default:
+				d.subscriptions[subscription] = struct{}{}
+			}
+
+			continue
+		}
+
+		update := next.update
+
+		for subscription := range d.subscriptions {
+			subscription.deliver(VersionedChange{
+				PreviousVersion: update.PreviousVersion,
+				Version:         update.Version,
+				Change:          Clone(update.Change),
+			}, next.previousValue, next.value)
+		}
+
+		for watcher := range d.watchers {
+			watcher.notify(next.previousValue, next.value, update.Change)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the changes applied after the returned snapshot.
+func (d *SharedDocument) Subscribe(buffer int, backpressure Backpressure) *Subscription {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	updates := make(chan VersionedChange, buffer)
+
+	subscription := &Subscription{
+		Snapshot:     d.document.Value(),
+		Version:      d.document.Version(),
+		Updates:      updates,
+		document:     d,
+		backpressure: backpressure,
+		updates:      updates,
+		done:         make(chan struct{}),
+	}
+
+	if backpressure == BackpressureCoalesce {
+		subscription.signal = make(chan struct{}, 1)
+		go subscription.run()
+	}
+
+	// Registering through the queue places the subscription after the updates up to its version
+	// and before the later ones. It takes effect with the next publication.
+	d.enqueue(publication{subscription: subscription})
+
+	return subscription
+}
+
+// Subscription receives the changes applied to a SharedDocument.
+type Subscription struct {
+	// Snapshot is the value at Version, the version the first update follows.
+	Snapshot any
+	Version  uint64
+	// Updates is closed when the subscription is closed.
+	Updates <-chan VersionedChange
+
+	document     *SharedDocument
+	backpressure Backpressure
+	updates      chan VersionedChange
+	done         chan struct{}
+	closeOnce    sync.Once
+
+	// Coalescing state; pendingBase is the value at pending.PreviousVersion.
+	signal      chan struct{}
+	mutex       sync.Mutex
+	pending     VersionedChange
+	pendingBase any
+	hasPending  bool
+	dropped     uint64
+}
+
+// Dropped returns the number of updates discarded with BackpressureDrop.
+func (s *Subscription) Dropped() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.dropped
+}
+
+// Close unsubscribes and closes Updates. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.document.publishMutex.Lock()
+		delete(s.document.subscriptions, s)
+		if s.backpressure != BackpressureCoalesce {
+			close(s.updates)
+		}
+		s.document.publishMutex.Unlock()
+	})
+}
+
+// deliver is called with the publish lock held, with the values before and after the update.
+func (s *Subscription) deliver(update VersionedChange, previousValue, value any) {
+	switch s.backpressure {
+	case BackpressureBlock:
+		select {
+		case s.updates <- update:
+		case <-s.done:
+		}
+	case BackpressureCoalesce:
+		s.mutex.Lock()
+		if s.hasPending {
+			s.pending.Version = update.Version
+			s.pending.Change = s.coalesce(update.Change, value)
+		} else {
+			s.pending, s.pendingBase, s.hasPending = update, previousValue, true
+		}
+		s.mutex.Unlock()
+
+		select {
+		case s.signal <- struct{}{}:
+		default:
+		}
+	default:
+		select {
+		case s.updates <- update:
+		default:
+			s.mutex.Lock()
+			s.dropped++
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *Subscription) run() {
+	defer close(s.updates)
+
+	for {
+		select {
+		case <-s.signal:
+		case <-s.done:
+			return
+		}
+
+		s.mutex.Lock()
+		update, hasPending := s.pending, s.hasPending
+		s.pending, s.pendingBase, s.hasPending = VersionedChange{}, nil, false
+		s.mutex.Unlock()
+
+		if !hasPending {
+			continue
+		}
+
+		select {
+		case s.updates <- update:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// coalesce composes the pending change with the next one. When the composition cannot express
+// the sequence, the pending change becomes the difference from the value at its previous version.
+func (s *Subscription) coalesce(change any, value any) any {
+	composed, err := Compose(s.pending.Change, change)
+	if err == nil && Equal(Merge(Clone(s.pendingBase), Clone(composed), true), value) {
+		return composed
+	}
+
+	return Difference(s.pendingBase, value)
+}
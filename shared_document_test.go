@@ -0,0 +1,243 @@
+package cofly_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestSharedDocument(t *testing.T) {
+	t.Run("concurrent-apply-and-read", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"count": 0})
+
+		var wait sync.WaitGroup
+		for range 8 {
+			wait.Add(2)
+
+			go func() {
+				defer wait.Done()
+				for range 50 {
+					if _, err := document.Apply(map[string]any{"count": cofly.Increment(1)}); err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}
+			}()
+
+			go func() {
+				defer wait.Done()
+				for range 50 {
+					document.Read(func(value any, version uint64) {
+						_ = cofly.Clone(value)
+					})
+				}
+			}()
+		}
+		wait.Wait()
+
+		if got := document.Value(); !reflect.DeepEqual(got, map[string]any{"count": 400}) {
+			t.Fatalf("unexpected value %#v", got)
+		}
+		if version := document.Version(); version != 400 {
+			t.Fatalf("expected version 400, got %d", version)
+		}
+	})
+
+	t.Run("block-delivers-every-update-in-order", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"count": 0})
+		subscription := document.Subscribe(0, cofly.BackpressureBlock)
+
+		replica := subscription.Snapshot
+		received := make(chan uint64)
+
+		go func() {
+			version := subscription.Version
+			for update := range subscription.Updates {
+				if update.PreviousVersion != version {
+					t.Errorf("expected update after %d, got %#v", version, update)
+				}
+				version = update.Version
+				replica = cofly.Merge(replica, update.Change, true)
+			}
+			received <- version
+		}()
+
+		for range 20 {
+			if _, err := document.Apply(map[string]any{"count": cofly.Increment(1)}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		subscription.Close()
+
+		if version := <-received; version != 20 {
+			t.Fatalf("expected version 20, got %d", version)
+		}
+		if !reflect.DeepEqual(replica, document.Value()) {
+			t.Fatalf("expected %#v, got %#v", document.Value(), replica)
+		}
+	})
+
+	t.Run("drop-discards-updates-that-do-not-fit", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{})
+		subscription := document.Subscribe(1, cofly.BackpressureDrop)
+		defer subscription.Close()
+
+		for _, value := range []int{1, 2, 3} {
+			if _, err := document.Apply(map[string]any{"a": value}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		update := <-subscription.Updates
+		if update.Version != 1 || !reflect.DeepEqual(update.Change, map[string]any{"a": 1}) {
+			t.Fatalf("unexpected update %#v", update)
+		}
+		if dropped := subscription.Dropped(); dropped != 2 {
+			t.Fatalf("expected 2 dropped updates, got %d", dropped)
+		}
+	})
+
+	t.Run("coalesce-composes-pending-updates", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"count": 0, "list": []any{"a"}})
+		subscription := document.Subscribe(0, cofly.BackpressureCoalesce)
+		defer subscription.Close()
+
+		changes := []any{
+			map[string]any{"count": cofly.Increment(1)},
+			map[string]any{"list": map[string]any{"1..": []any{"b"}}},
+			map[string]any{"count": cofly.Increment(2), "list": map[string]any{"0..1": []any{}}},
+		}
+		for _, change := range changes {
+			if _, err := document.Apply(change); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		replica := subscription.Snapshot
+		version := subscription.Version
+
+		timeout := time.After(5 * time.Second)
+		for version != 3 {
+			select {
+			case update := <-subscription.Updates:
+				if update.PreviousVersion != version {
+					t.Fatalf("expected update after %d, got %#v", version, update)
+				}
+				version = update.Version
+				replica = cofly.Merge(replica, update.Change, true)
+			case <-timeout:
+				t.Fatalf("timed out at version %d", version)
+			}
+		}
+
+		if want := map[string]any{"count": 3, "list": []any{"b"}}; !reflect.DeepEqual(replica, want) {
+			t.Fatalf("expected %#v, got %#v", want, replica)
+		}
+	})
+
+	t.Run("coalesce-replaces-recreated-objects", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"object": map[string]any{"x": 1}})
+		subscription := document.Subscribe(0, cofly.BackpressureCoalesce)
+		defer subscription.Close()
+
+		changes := []any{
+			map[string]any{"object": cofly.Undefined},
+			map[string]any{"object": map[string]any{"y": 2}},
+		}
+		for _, change := range changes {
+			if _, err := document.Apply(change); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		replica := subscription.Snapshot
+		version := subscription.Version
+
+		timeout := time.After(5 * time.Second)
+		for version != 2 {
+			select {
+			case update := <-subscription.Updates:
+				version = update.Version
+				replica = cofly.Merge(replica, update.Change, true)
+			case <-timeout:
+				t.Fatalf("timed out at version %d", version)
+			}
+		}
+
+		if want := map[string]any{"object": map[string]any{"y": 2}}; !reflect.DeepEqual(replica, want) {
+			t.Fatalf("expected %#v, got %#v", want, replica)
+		}
+	})
+
+	t.Run("blocked-subscriber-does-not-block-readers", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"count": 0})
+		subscription := document.Subscribe(0, cofly.BackpressureBlock)
+		defer subscription.Close()
+
+		apply := func(value int) {
+			if _, err := document.Apply(map[string]any{"count": value}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+
+		// The first update blocks on the subscriber, the second one waits for it to be delivered.
+		go apply(1)
+
+		timeout := time.After(5 * time.Second)
+		for document.Version() != 1 {
+			select {
+			case <-timeout:
+				t.Fatalf("the update was not applied")
+			default:
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		go apply(2)
+		time.Sleep(10 * time.Millisecond)
+
+		read := make(chan struct{})
+		go func() {
+			_ = document.Value()
+			_ = document.Version()
+			close(read)
+		}()
+
+		select {
+		case <-read:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("readers are blocked by the subscriber")
+		}
+
+		for _, version := range []uint64{1, 2} {
+			if update := <-subscription.Updates; update.Version != version {
+				t.Fatalf("expected version %d, got %#v", version, update)
+			}
+		}
+	})
+
+	t.Run("close-unblocks-apply", func(t *testing.T) {
+		document := cofly.NewSharedDocument(nil)
+		subscription := document.Subscribe(0, cofly.BackpressureBlock)
+
+		applied := make(chan struct{})
+		go func() {
+			if _, err := document.Apply(1); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			close(applied)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		subscription.Close()
+		subscription.Close()
+
+		select {
+		case <-applied:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Apply is still blocked")
+		}
+	})
+}
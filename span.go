@@ -10,6 +10,26 @@ type span struct {
 	indexTo   int
 }
 
+// Span is a half-open range [From, To) of array positions, written as "From..To"
+// (or "From.." when it is empty).
+type Span struct {
+	From int
+	To   int
+}
+
+func ParseSpan(key string) (Span, bool) {
+	span, ok := parseSpan(key)
+	if !ok {
+		return Span{}, false
+	}
+
+	return Span{From: span.indexFrom, To: span.indexTo}, true
+}
+
+func (s Span) String() string {
+	return newSpan(s.From, s.To).string()
+}
+
 func newSpan(indexFrom, indexTo int) span {
 	return span{
 		indexFrom: indexFrom,
@@ -11,6 +11,103 @@ type splice struct {
 	value []any
 }
 
+// Splice is a single array edit: the elements in [From, To) are replaced with Values.
+type Splice struct {
+	From   int
+	To     int
+	Values []any
+}
+
+// Splices is an array change kept in numeric form. It is equivalent to a splice-map
+// and is converted to span keys only when it is serialized (see Map).
+type Splices []Splice
+
+func ParseSplices(changeMap map[string]any) (Splices, bool) {
+	parsedSplices := parseSplices(changeMap)
+	if len(parsedSplices) == 0 {
+		return nil, false
+	}
+
+	sortSplices(parsedSplices)
+
+	splices := make(Splices, 0, len(parsedSplices))
+
+	for _, splice := range parsedSplices {
+		splices = append(splices, Splice{
+			From:   splice.span.indexFrom,
+			To:     splice.span.indexTo,
+			Values: splice.value,
+		})
+	}
+
+	return splices, true
+}
+
+func (s Splice) Span() Span {
+	return Span{From: s.From, To: s.To}
+}
+
+// Validate reports whether splices can be written as a splice-map:
+// spans must be well-formed, distinct and must not overlap.
+func (splices Splices) Validate() error {
+	parsedSplices := make([]splice, 0, len(splices))
+
+	for _, s := range splices {
+		if s.From < 0 || s.From > s.To {
+			return fmt.Errorf("invalid splice: span [%d, %d)", s.From, s.To)
+		}
+
+		parsedSplices = append(parsedSplices, splice{span: newSpan(s.From, s.To)})
+	}
+
+	sortSplices(parsedSplices)
+
+	for i := 1; i < len(parsedSplices); i++ {
+		if parsedSplices[i-1].span == parsedSplices[i].span {
+			return fmt.Errorf("invalid splice-map: duplicate span %q", parsedSplices[i].span.string())
+		}
+	}
+
+	return checkSplices(parsedSplices)
+}
+
+func (splices Splices) sorted() Splices {
+	sortedSplices := slices.Clone(splices)
+
+	slices.SortFunc(sortedSplices, func(a, b Splice) int {
+		return compareSpans(newSpan(a.From, a.To), newSpan(b.From, b.To))
+	})
+
+	return sortedSplices
+}
+
+func (splices Splices) Map() map[string]any {
+	changeMap := make(map[string]any, len(splices))
+
+	for _, splice := range splices {
+		changeMap[newSpan(splice.From, splice.To).string()] = splice.Values
+	}
+
+	return changeMap
+}
+
+func (splices Splices) parse() []splice {
+	parsedSplices := make([]splice, 0, len(splices))
+
+	for _, s := range splices {
+		if s.From < 0 || s.From > s.To {
+			panic(fmt.Sprintf("invalid splice: span [%d, %d)", s.From, s.To))
+		}
+
+		parsedSplices = append(parsedSplices, splice{
+			span:  newSpan(s.From, s.To),
+			value: s.Values,
+		})
+	}
+
+	return parsedSplices
+}
+
 func parseSplice(key string, value any) (splice, bool) {
 	span, ok := parseSpan(key)
 	if !ok {
@@ -81,15 +178,30 @@ func parseSplices(changeMap map[string]any) []splice {
 // 	return string(buffer)
 // }
 
+// sortSplices orders splices by span start. An insertion ("i..") sorts before a splice
+// starting at the same index, because it happens in front of that element.
 func sortSplices(splices []splice) {
 	slices.SortFunc(splices, func(a, b splice) int {
-		return cmp.Compare(a.span.indexFrom, b.span.indexFrom)
+		return compareSpans(a.span, b.span)
 	})
 }
 
+func compareSpans(a, b span) int {
+	return cmp.Or(
+		cmp.Compare(a.indexFrom, b.indexFrom),
+		cmp.Compare(a.indexTo, b.indexTo),
+	)
+}
+
 func validateSplices(splices []splice) {
+	if err := checkSplices(splices); err != nil {
+		panic(err.Error())
+	}
+}
+
+func checkSplices(splices []splice) error {
 	if len(splices) <= 1 {
-		return
+		return nil
 	}
 
 	// Assumes splices are sorted by span.indexFrom.
@@ -101,13 +213,15 @@ func validateSplices(splices []splice) {
 		// Spans are half-open ranges [from, to).
 		// Two splices overlap if previousSpan.indexTo > currentSpan.indexFrom.
 		if previousSpan.indexTo > currentSpan.indexFrom {
-			panic(fmt.Sprintf(
+			return fmt.Errorf(
 				"invalid splice-map: overlapping spans %q and %q",
 				previousSpan.string(),
 				currentSpan.string(),
-			))
+			)
 		}
 
 		previousSpan = currentSpan
 	}
+
+	return nil
 }
@@ -67,3 +67,15 @@ func TestSortSplices(t *testing.T) {
 		t.Fatalf("unexpected order: %#v", sp)
 	}
 }
+
+func TestSortSplicesInsertionFirst(t *testing.T) {
+	sp := []splice{
+		{span: span{indexFrom: 2, indexTo: 3}},
+		{span: span{indexFrom: 2, indexTo: 2}},
+	}
+	sortSplices(sp)
+	if sp[0].span.indexTo != 2 || sp[1].span.indexTo != 3 {
+		t.Fatalf("unexpected order: %#v", sp)
+	}
+	validateSplices(sp)
+}
@@ -0,0 +1,252 @@
+package cofly
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+type ChangeStats struct {
+	// SetKeys counts object keys given a value that is not merged further as an object change
+	// (replacements, increments, splices and set changes).
+	SetKeys     int
+	DeletedKeys int
+
+	// Array splices; set changes count their added and removed elements.
+	InsertedElements int
+	RemovedElements  int
+	ReplacedElements int
+
+	// MaxDepth is the nesting depth of the change: 0 for a primitive, 1 for a flat map or array.
+	MaxDepth int
+	// EncodedSize is the size of the change encoded by MarshalChange, in bytes.
+	EncodedSize int
+}
+
+// Stats describes a change. It panics on values MarshalChange rejects.
+func Stats(change any) ChangeStats {
+	var stats ChangeStats
+
+	stats.collect(change)
+	stats.MaxDepth = depth(change)
+	stats.EncodedSize = EncodedSize(change)
+
+	return stats
+}
+
+// IsChangeCheaper reports whether the encoded change is smaller than the encoded new value.
+func IsChangeCheaper(change, newValue any) bool {
+	return EncodedSize(change) < EncodedSize(newValue)
+}
+
+func (stats *ChangeStats) collect(change any) {
+	var splices []splice
+
+	switch change := change.(type) {
+	case Splices:
+		splices = change.parse()
+	case map[string]any:
+		if change == nil {
+			return
+		}
+
+		if _, ok := parseIncrement(change); ok {
+			return
+		}
+
+		if setChange, ok := parseSetChange(change); ok {
+			stats.InsertedElements += len(setChange.add)
+			stats.RemovedElements += len(setChange.remove)
+			return
+		}
+
+		if len(parseStringSplices(change)) > 0 {
+			return
+		}
+
+		splices = parseSplices(change)
+		if len(splices) == 0 {
+			for _, value := range change {
+				if value == Undefined {
+					stats.DeletedKeys++
+					continue
+				}
+
+				if valueMap, ok := value.(map[string]any); !ok || valueMap == nil || isOperationMap(valueMap) {
+					stats.SetKeys++
+				}
+
+				stats.collect(value)
+			}
+
+			return
+		}
+	default:
+		return
+	}
+
+	for _, splice := range splices {
+		replacedCount := min(splice.span.length(), len(splice.value))
+
+		stats.ReplacedElements += replacedCount
+		stats.RemovedElements += splice.span.length() - replacedCount
+		stats.InsertedElements += len(splice.value) - replacedCount
+
+		// Replaced elements are changes to the old elements.
+		for _, value := range splice.value[:replacedCount] {
+			stats.collect(value)
+		}
+	}
+}
+
+func depth(value any) int {
+	maxChildDepth := 0
+
+	switch value := normalize(value).(type) {
+	case map[string]any:
+		if value == nil {
+			return 0
+		}
+
+		for _, child := range value {
+			maxChildDepth = max(maxChildDepth, depth(child))
+		}
+	case []any:
+		if value == nil {
+			return 0
+		}
+
+		for _, child := range value {
+			maxChildDepth = max(maxChildDepth, depth(child))
+		}
+	case Splices:
+		if value == nil {
+			return 0
+		}
+
+		for _, splice := range value {
+			maxChildDepth = max(maxChildDepth, depth(splice.Values))
+		}
+	default:
+		return 0
+	}
+
+	return 1 + maxChildDepth
+}
+
+// EncodedSize returns the size of the value encoded by MarshalChange without encoding it.
+// It panics on values MarshalChange rejects.
+func EncodedSize(value any) int {
+	var scratch [64]byte
+
+	switch value := value.(type) {
+	case nil:
+		return len("null")
+	case bool:
+		if value {
+			return len("true")
+		}
+
+		return len("false")
+	case int, int8, int16, int32, int64:
+		return len(strconv.AppendInt(scratch[:0], toInt64(value), 10))
+	case uint, uint8, uint16, uint32, uint64:
+		return len(strconv.AppendUint(scratch[:0], toUint64(value), 10))
+	case float32, float64:
+		bits := 64
+		if _, ok := value.(float32); ok {
+			bits = 32
+		}
+
+		buffer, err := appendJSONFloat(scratch[:0], toFloat64(value), bits)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		return len(buffer)
+	case string:
+		return jsonStringSize(value)
+	case map[string]any:
+		if value == nil {
+			return len("null")
+		}
+
+		// Braces, and a colon per key and commas between the pairs.
+		size := 2 + max(0, 2*len(value)-1)
+
+		for key, child := range value {
+			size += jsonStringSize(key) + EncodedSize(child)
+		}
+
+		return size
+	case []any:
+		if value == nil {
+			return len("null")
+		}
+
+		size := 2 + max(0, len(value)-1)
+
+		for _, element := range value {
+			size += EncodedSize(element)
+		}
+
+		return size
+	case Splices:
+		if value == nil {
+			return len("null")
+		}
+
+		return EncodedSize(value.Map())
+	default:
+		if value, ok := normalizeCollection(value); ok {
+			return EncodedSize(value)
+		}
+
+		if isLeaf(value) {
+			data, err := leafJSON(value)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			return len(data)
+		}
+
+		panic(fmt.Sprintf("type [%T] unsupported", value))
+	}
+}
+
+// jsonStringSize mirrors appendJSONString.
+func jsonStringSize(value string) int {
+	size := 2
+
+	for index := 0; index < len(value); {
+		if char := value[index]; char < utf8.RuneSelf {
+			switch {
+			case char == '"' || char == '\\' || char == '\n' || char == '\r' || char == '\t':
+				size += 2
+			case char < 0x20:
+				size += 6
+			default:
+				size++
+			}
+
+			index++
+			continue
+		}
+
+		char, runeSize := utf8.DecodeRuneInString(value[index:])
+
+		switch {
+		case char == utf8.RuneError && runeSize == 1:
+			size += 6
+		case char == '\u2028' || char == '\u2029':
+			size += 6
+		default:
+			size += runeSize
+		}
+
+		index += runeSize
+	}
+
+	return size
+}
@@ -0,0 +1,95 @@
+package cofly_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestStats(t *testing.T) {
+	change := map[string]any{
+		"title": "final",
+		"gone":  cofly.Undefined,
+		"count": cofly.Increment(2),
+		"tags":  map[string]any{"$add": []any{"c", "d"}, "$remove": []any{"a"}},
+		"nested": map[string]any{
+			"items": map[string]any{
+				"0..":  []any{"first"},
+				"0..1": []any{map[string]any{"name": "uno", "old": cofly.Undefined}},
+				"2..4": []any{},
+			},
+		},
+	}
+
+	got := cofly.Stats(change)
+	want := cofly.ChangeStats{
+		SetKeys:          5, // title, count, tags, items, name
+		DeletedKeys:      2, // gone, old
+		InsertedElements: 3, // "first", "c", "d"
+		RemovedElements:  3, // two spliced elements, "a"
+		ReplacedElements: 1,
+		MaxDepth:         5,
+		EncodedSize:      len(mustMarshalChange(t, change)),
+	}
+
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if stats := cofly.Stats(1); stats != (cofly.ChangeStats{EncodedSize: 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	values := []any{
+		nil, true, false, 0, -12, uint64(math.MaxUint64), 1.5, float32(0.1), 1e21, 1e-7,
+		"", "plain", "quote\" backslash\\ newline\n tab\t nul\x00 bell\x07", "\u2028 \u2029 é 日本", "\xff",
+		cofly.Undefined,
+		[]any{}, []any{1, "a", nil},
+		map[string]any{}, map[string]any{"a": 1, "b\n": []any{map[string]any{}}},
+		cofly.Splices{{From: 1, To: 2, Values: []any{"x"}}},
+	}
+
+	for _, value := range values {
+		if got, want := cofly.EncodedSize(value), len(mustMarshalChange(t, value)); got != want {
+			t.Fatalf("%#v: expected %d, got %d", value, want, got)
+		}
+	}
+
+	if !cofly.IsChangeCheaper(map[string]any{"1..2": []any{"x"}}, []any{"a", "x", "c", "d"}) {
+		t.Fatalf("expected the splice to be cheaper")
+	}
+	if cofly.IsChangeCheaper(map[string]any{"0..2": []any{"x", "y"}}, []any{"x", "y"}) {
+		t.Fatalf("expected the snapshot to be cheaper")
+	}
+}
+
+func FuzzEncodedSize(f *testing.F) {
+	f.Add([]byte("seed"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		value := genValue(&byteReader{b: data}, 0)
+
+		encoded, err := cofly.MarshalChange(value)
+		if err != nil {
+			t.Skip()
+		}
+
+		if got := cofly.EncodedSize(value); got != len(encoded) {
+			t.Fatalf("%#v: expected %d, got %d", value, len(encoded), got)
+		}
+	})
+}
+
+func mustMarshalChange(t *testing.T, value any) []byte {
+	t.Helper()
+
+	data, err := cofly.MarshalChange(value)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return data
+}
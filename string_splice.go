@@ -0,0 +1,161 @@
+package cofly
+
+import "fmt"
+
+// maxStringDifferenceRunes bounds the part of a string (after trimming the common prefix and suffix)
+// that is diffed rune by rune, and maxStringEditDistance the number of runes inserted and deleted.
+// Longer or larger edits become a single splice.
+const (
+	maxStringDifferenceRunes = 4096
+	maxStringEditDistance    = 256
+)
+
+type stringSplice struct {
+	span  span
+	value string
+}
+
+func parseStringSplices(changeMap map[string]any) []stringSplice {
+	splices := make([]stringSplice, 0, len(changeMap))
+
+	for spliceKey, changeValue := range changeMap {
+		span, ok := parseSpan(spliceKey)
+		if !ok {
+			return nil
+		}
+
+		value, ok := changeValue.(string)
+		if !ok || value == Undefined {
+			return nil
+		}
+
+		splices = append(splices, stringSplice{
+			span:  span,
+			value: value,
+		})
+	}
+
+	return splices
+}
+
+func mergeStringSplicesIntoString(targetString string, changeSplices []stringSplice) string {
+	sortStringSplices(changeSplices)
+
+	spans := make([]splice, len(changeSplices))
+	for index, changeSplice := range changeSplices {
+		spans[index] = splice{span: changeSplice.span}
+	}
+	validateSplices(spans)
+
+	targetRunes := []rune(targetString)
+	outputRunes := make([]rune, 0, len(targetRunes))
+	targetRunesCursor := 0
+
+	for _, changeSplice := range changeSplices {
+		if changeSplice.span.indexTo > len(targetRunes) {
+			panic(fmt.Sprintf("changeSplice span is past the end of the string: %q", changeSplice.span.string()))
+		}
+
+		outputRunes = append(outputRunes, targetRunes[targetRunesCursor:changeSplice.span.indexFrom]...)
+		outputRunes = append(outputRunes, []rune(changeSplice.value)...)
+		targetRunesCursor = changeSplice.span.indexTo
+	}
+
+	outputRunes = append(outputRunes, targetRunes[targetRunesCursor:]...)
+	return string(outputRunes)
+}
+
+// stringDifference returns a string splice-map (spans over rune offsets, string payloads)
+// when it is shorter than newString itself, and newString otherwise.
+func (options *DifferenceOptions) stringDifference(oldString, newString string) any {
+	oldRunes, newRunes := []rune(oldString), []rune(newString)
+
+	prefixLength := 0
+	for prefixLength < len(oldRunes) && prefixLength < len(newRunes) && oldRunes[prefixLength] == newRunes[prefixLength] {
+		prefixLength++
+	}
+
+	suffixLength := 0
+	for suffixLength < len(oldRunes)-prefixLength && suffixLength < len(newRunes)-prefixLength &&
+		oldRunes[len(oldRunes)-1-suffixLength] == newRunes[len(newRunes)-1-suffixLength] {
+		suffixLength++
+	}
+
+	oldMiddle := oldRunes[prefixLength : len(oldRunes)-suffixLength]
+	newMiddle := newRunes[prefixLength : len(newRunes)-suffixLength]
+
+	var operations []operation
+	isDiffed := false
+
+	if len(oldMiddle)+len(newMiddle) <= maxStringDifferenceRunes {
+		operations, isDiffed = boundedMyers(len(oldMiddle), len(newMiddle), maxStringEditDistance, func(x, y int) bool {
+			return oldMiddle[x] == newMiddle[y]
+		})
+	}
+
+	if !isDiffed {
+		operations = make([]operation, 0, len(oldMiddle)+len(newMiddle))
+
+		for range oldMiddle {
+			operations = append(operations, operationDelete)
+		}
+
+		for range newMiddle {
+			operations = append(operations, operationInsert)
+		}
+	}
+
+	changes := make(map[string]any)
+	encodedSize := 0
+	hasUndefined := false
+	oldI, newI := prefixLength, prefixLength
+	open := false
+	curFrom, curTo, curValueFrom := 0, 0, 0
+
+	flush := func() {
+		if !open {
+			return
+		}
+
+		key := newSpan(curFrom, curTo).string()
+		value := string(newRunes[curValueFrom:newI])
+		changes[key] = value
+		encodedSize += len(key) + len(value) + len(`"":"",`)
+		hasUndefined = hasUndefined || value == Undefined
+		open = false
+	}
+
+	for _, operation := range operations {
+		if operation == operationSkip {
+			flush()
+			oldI++
+			newI++
+			continue
+		}
+
+		if !open {
+			open = true
+			curFrom, curTo, curValueFrom = oldI, oldI, newI
+		}
+
+		if operation == operationDelete {
+			curTo++
+			oldI++
+		} else {
+			newI++
+		}
+	}
+
+	flush()
+
+	if len(changes) == 0 {
+		return Undefined
+	}
+
+	// A payload equal to Undefined would not parse as a string splice.
+	if encodedSize >= len(newString) || hasUndefined {
+		return newString
+	}
+
+	return changes
+}
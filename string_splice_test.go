@@ -0,0 +1,169 @@
+package cofly_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestStringSplices(t *testing.T) {
+	options := cofly.DifferenceOptions{StringSpliceThreshold: 16}
+
+	t.Run("single-character-edit", func(t *testing.T) {
+		oldText := strings.Repeat("a", 100) + "b" + strings.Repeat("c", 100)
+		newText := strings.Repeat("a", 100) + "B" + strings.Repeat("c", 100)
+
+		change := cofly.DifferenceWithOptions(oldText, newText, options)
+		if want := map[string]any{"100..101": "B"}; !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		if got := cofly.Merge(oldText, change, true); got != newText {
+			t.Fatalf("expected %q, got %q", newText, got)
+		}
+	})
+
+	t.Run("rune-offsets", func(t *testing.T) {
+		oldText := "привет, мир! " + strings.Repeat("ж", 20)
+		newText := "привет, новый мир! " + strings.Repeat("ж", 20)
+
+		change := cofly.DifferenceWithOptions(oldText, newText, options)
+		if want := map[string]any{"8..": "новый "}; !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		if got := cofly.Merge(oldText, change, true); got != newText {
+			t.Fatalf("expected %q, got %q", newText, got)
+		}
+	})
+
+	t.Run("short-or-rewritten-strings-are-replaced", func(t *testing.T) {
+		if got := cofly.DifferenceWithOptions("short", "shirt", options); got != "shirt" {
+			t.Fatalf("expected replacement, got %#v", got)
+		}
+
+		oldText := strings.Repeat("x", 40)
+		newText := strings.Repeat("y", 40)
+		if got := cofly.DifferenceWithOptions(oldText, newText, options); got != newText {
+			t.Fatalf("expected replacement, got %#v", got)
+		}
+
+		if got := cofly.Difference(oldText+"a", oldText+"b"); got != oldText+"b" {
+			t.Fatalf("expected replacement without option, got %#v", got)
+		}
+	})
+
+	t.Run("random-edits-round-trip", func(t *testing.T) {
+		random := rand.New(rand.NewSource(1))
+		alphabet := []rune("abcdé字 \n")
+
+		randomText := func(n int) []rune {
+			text := make([]rune, n)
+			for i := range text {
+				text[i] = alphabet[random.Intn(len(alphabet))]
+			}
+			return text
+		}
+
+		for range 200 {
+			oldRunes := randomText(random.Intn(80))
+			newRunes := append([]rune(nil), oldRunes...)
+
+			for range random.Intn(5) {
+				at := random.Intn(len(newRunes) + 1)
+				cut := min(len(newRunes)-at, random.Intn(4))
+				newRunes = append(newRunes[:at], append(randomText(random.Intn(4)), newRunes[at+cut:]...)...)
+			}
+
+			oldText, newText := string(oldRunes), string(newRunes)
+			change := cofly.DifferenceWithOptions(oldText, newText, cofly.DifferenceOptions{StringSpliceThreshold: 1})
+
+			got := cofly.Merge(oldText, change, true)
+			if change == cofly.Undefined {
+				got = oldText
+			}
+			if got != newText {
+				t.Fatalf("round-trip failed: old=%q new=%q change=%#v got=%q", oldText, newText, change, got)
+			}
+		}
+	})
+
+	t.Run("large-edits-become-one-splice", func(t *testing.T) {
+		middle := []rune(strings.Repeat("abcd", 500))
+		for i := 1; i < len(middle); i += 4 {
+			middle[i] = 'X'
+		}
+		padding := strings.Repeat("-", 4000)
+		oldText := padding + strings.Repeat("abcd", 500) + padding
+		newText := padding + string(middle) + padding
+
+		change := cofly.DifferenceWithOptions(oldText, newText, options)
+		if want := map[string]any{"4001..5998": string(middle[1:1998])}; !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected a single splice, got %d keys", reflect.ValueOf(change).Len())
+		}
+
+		if got := cofly.Merge(oldText, change, true); got != newText {
+			t.Fatalf("round-trip failed")
+		}
+	})
+
+	t.Run("nested-in-maps", func(t *testing.T) {
+		body := strings.Repeat("# Notes\n", 10)
+		oldValue := map[string]any{"body": body}
+		newValue := map[string]any{"body": body + "- item\n"}
+
+		change := cofly.DifferenceWithOptions(oldValue, newValue, options)
+		if want := map[string]any{"body": map[string]any{"80..": "- item\n"}}; !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		got := cofly.Merge(cofly.Clone(oldValue), change, true)
+		if !reflect.DeepEqual(got, newValue) {
+			t.Fatalf("expected %#v, got %#v", newValue, got)
+		}
+	})
+
+	t.Run("string-splice-map-is-object-change-for-maps", func(t *testing.T) {
+		got := cofly.Merge(map[string]any{}, map[string]any{"0..1": "x"}, true)
+		if want := map[string]any{"0..1": "x"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("undefined-payload-falls-back-to-replacement", func(t *testing.T) {
+		oldText := strings.Repeat("a", 40)
+		newText := strings.Repeat("a", 20) + cofly.Undefined + strings.Repeat("a", 20)
+
+		change := cofly.DifferenceWithOptions(oldText, newText, options)
+		if change != newText {
+			t.Fatalf("expected replacement, got %#v", change)
+		}
+		if got := cofly.Merge(oldText, change, true); got != newText {
+			t.Fatalf("expected %q, got %q", newText, got)
+		}
+	})
+
+	t.Run("span-like-objects-replace-other-values", func(t *testing.T) {
+		for _, oldValue := range []any{5, nil, true, []any{"x"}} {
+			oldObject := map[string]any{"a": oldValue}
+			newObject := map[string]any{"a": map[string]any{"1..2": "x"}}
+
+			change := cofly.DifferenceWithOptions(oldObject, newObject, options)
+			if got := cofly.Merge(cofly.Clone(oldObject), change, true); !reflect.DeepEqual(got, newObject) {
+				t.Fatalf("expected %#v, got %#v", newObject, got)
+			}
+		}
+	})
+
+	t.Run("invalid-string-splices-panic", func(t *testing.T) {
+		mustPanic(t, func() {
+			_ = cofly.Merge("abc", map[string]any{"2..5": "x"}, true)
+		})
+		mustPanic(t, func() {
+			_ = cofly.Merge("abcd", map[string]any{"0..2": "x", "1..3": "y"}, true)
+		})
+	})
+}
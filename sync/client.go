@@ -0,0 +1,217 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rnkv/cofly-go"
+)
+
+type ClientOptions struct {
+	// ID identifies the client to the server. A random one is generated when it is empty.
+	ID string
+	// Version resumes from a version the client already has. Zero starts with a snapshot.
+	Version uint64
+	// Header is sent with the requests.
+	Header http.Header
+	// HTTPClient is used for Server-Sent Events and acks. Zero means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client receives the Messages of a Server. It is not safe for concurrent use,
+// except for Close, which interrupts Receive.
+type Client struct {
+	id         string
+	url        string
+	header     http.Header
+	httpClient *http.Client
+
+	websocket *websocketConn
+	sse       *sseReader
+	closeSSE  func()
+
+	// isResyncing is set by Apply until the requested snapshot arrives.
+	isResyncing bool
+}
+
+// Dial opens a stream: a WebSocket for "ws" and "wss" URLs, Server-Sent Events for "http" and "https".
+// ctx bounds the connection, not the stream.
+func Dial(ctx context.Context, rawURL string, options ClientOptions) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ID == "" {
+		options.ID = newClientID()
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+
+	query := u.Query()
+	query.Set("client", options.ID)
+	if options.Version > 0 {
+		query.Set("version", strconv.FormatUint(options.Version, 10))
+	}
+	u.RawQuery = query.Encode()
+
+	client := &Client{
+		id:         options.ID,
+		header:     options.Header,
+		httpClient: options.HTTPClient,
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		client.websocket, err = dialWebSocket(ctx, u.String(), options.Header)
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		stop := context.AfterFunc(ctx, cancel)
+
+		request, err := http.NewRequestWithContext(streamCtx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		for name, values := range options.Header {
+			request.Header[name] = values
+		}
+		request.Header.Set("Accept", "text/event-stream")
+
+		response, err := options.HTTPClient.Do(request)
+		if !stop() || err != nil {
+			cancel()
+			if err == nil {
+				response.Body.Close()
+				err = ctx.Err()
+			}
+			return nil, err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("sync: unexpected status %s", response.Status)
+		}
+
+		client.url = u.String()
+		client.sse = newSSEReader(response.Body)
+		client.closeSSE = func() {
+			cancel()
+			response.Body.Close()
+		}
+	default:
+		return nil, fmt.Errorf("sync: unsupported scheme %q", u.Scheme)
+	}
+
+	return client, nil
+}
+
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Receive waits for the next Message. It returns io.EOF when the stream ends.
+func (c *Client) Receive() (Message, error) {
+	if c.websocket != nil {
+		return c.websocket.receive()
+	}
+
+	return c.sse.receive()
+}
+
+// Ack tells the server that the client applied the given version.
+func (c *Client) Ack(ctx context.Context, version uint64) error {
+	return c.send(ctx, Message{Type: MessageAck, Client: c.id, Version: version})
+}
+
+// Apply applies a received message to the replica and acknowledges it. When the replica
+// cannot apply it (a gap in the versions, an invalid change or a checksum mismatch), Apply asks
+// the server for a snapshot instead. Only errors of the connection are returned.
+func (c *Client) Apply(ctx context.Context, replica *cofly.Replica, message Message) error {
+	update := cofly.VersionedChange{
+		PreviousVersion: message.PreviousVersion,
+		Version:         message.Version,
+		Change:          message.Value.Value,
+	}
+
+	err := replica.Apply(message.Type == MessageSnapshot, update, message.Checksum)
+
+	switch {
+	case err == nil:
+		if message.Type == MessageSnapshot {
+			c.isResyncing = false
+		}
+
+		return c.Ack(ctx, replica.Version())
+	case errors.Is(err, cofly.ErrDuplicateVersion):
+		return nil
+	case errors.Is(err, cofly.ErrReplicaNotSynced) && c.isResyncing:
+		return nil
+	default:
+		c.isResyncing = true
+		return c.Resync(ctx)
+	}
+}
+
+// Resync asks the server for a snapshot.
+func (c *Client) Resync(ctx context.Context) error {
+	return c.send(ctx, Message{Type: MessageResync, Client: c.id})
+}
+
+func (c *Client) send(ctx context.Context, message Message) error {
+	if c.websocket != nil {
+		return c.websocket.send(message)
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for name, values := range c.header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1<<10))
+		return fmt.Errorf("sync: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (c *Client) Close() error {
+	if c.websocket != nil {
+		return c.websocket.close()
+	}
+
+	c.closeSSE()
+	return nil
+}
@@ -0,0 +1,108 @@
+package sync_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+	"github.com/rnkv/cofly-go/sync"
+)
+
+func TestClientApply(t *testing.T) {
+	newServer := func(t *testing.T) (*cofly.SharedDocument, string) {
+		t.Helper()
+
+		document := cofly.NewSharedDocument(map[string]any{"count": 0, "list": []any{}})
+		server := httptest.NewServer(sync.NewServer(document, sync.ServerOptions{Checksums: true}))
+		t.Cleanup(server.Close)
+
+		return document, server.URL
+	}
+
+	dial := func(t *testing.T, url string, options sync.ClientOptions) *sync.Client {
+		t.Helper()
+
+		client, err := sync.Dial(context.Background(), url, options)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	// follow applies messages until the replica is synced at the given version.
+	follow := func(t *testing.T, client *sync.Client, replica *cofly.Replica, version uint64) []string {
+		t.Helper()
+
+		var types []string
+		for !replica.IsSynced() || replica.Version() != version {
+			message, err := client.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if message.Checksum == "" {
+				t.Fatalf("expected a checksum in %#v", message)
+			}
+
+			types = append(types, message.Type)
+
+			if err := client.Apply(context.Background(), replica, message); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		return types
+	}
+
+	t.Run("follows-document", func(t *testing.T) {
+		document, url := newServer(t)
+		client := dial(t, url, sync.ClientOptions{})
+		replica := cofly.NewReplica()
+
+		follow(t, client, replica, 0)
+
+		for index := range 5 {
+			if _, err := document.Apply(map[string]any{
+				"count": cofly.Increment(1),
+				"list":  map[string]any{"0..": []any{index}},
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		follow(t, client, replica, 5)
+
+		if !cofly.Equal(replica.Value(), document.Value()) {
+			t.Fatalf("expected %#v, got %#v", document.Value(), replica.Value())
+		}
+	})
+
+	t.Run("resyncs-diverged-replica", func(t *testing.T) {
+		document, url := newServer(t)
+
+		for _, change := range []any{map[string]any{"count": 1}, map[string]any{"count": 2}} {
+			if _, err := document.Apply(change); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		// The replica claims version 1 but holds a different value.
+		replica := cofly.NewReplica()
+		diverged := map[string]any{"count": 1, "list": []any{"stale"}}
+		if err := replica.Apply(true, cofly.VersionedChange{Version: 1, Change: diverged}, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		client := dial(t, url, sync.ClientOptions{Version: 1})
+
+		types := follow(t, client, replica, 2)
+		if len(types) != 2 || types[0] != sync.MessageChange || types[1] != sync.MessageSnapshot {
+			t.Fatalf("expected a change then a snapshot, got %v", types)
+		}
+		if !cofly.Equal(replica.Value(), document.Value()) {
+			t.Fatalf("expected %#v, got %#v", document.Value(), replica.Value())
+		}
+	})
+}
@@ -0,0 +1,29 @@
+// Package sync serves a cofly.SharedDocument to remote clients over Server-Sent Events or WebSocket
+// and provides the matching client.
+package sync
+
+import (
+	"github.com/rnkv/cofly-go"
+)
+
+const (
+	// MessageSnapshot carries the whole value at Version.
+	MessageSnapshot = "snapshot"
+	// MessageChange carries the change from PreviousVersion to Version.
+	MessageChange = "change"
+	// MessageAck is sent by a client after it applied Version.
+	MessageAck = "ack"
+	// MessageResync is sent by a client to request a snapshot.
+	MessageResync = "resync"
+)
+
+// Message is the JSON object exchanged between the server and its clients.
+type Message struct {
+	Type            string       `json:"type"`
+	Client          string       `json:"client,omitempty"`
+	PreviousVersion uint64       `json:"previousVersion,omitempty"`
+	Version         uint64       `json:"version"`
+	Value           cofly.Change `json:"value"`
+	// Checksum is the cofly.Checksum of the value at Version, when the server sends checksums.
+	Checksum string `json:"checksum,omitempty"`
+}
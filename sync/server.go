@@ -0,0 +1,381 @@
+package sync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	gosync "sync"
+
+	"github.com/rnkv/cofly-go"
+)
+
+const defaultMaxLag = 64
+
+type ServerOptions struct {
+	// MaxLag is the number of versions a client may fall behind, counted from the last version it
+	// acknowledged, before it is resynced with a snapshot instead of receiving more changes.
+	// It is also the size of the per-client update buffer. Zero means 64.
+	MaxLag int
+	// Checksums adds the checksum of the value to every message, so that clients can detect divergence.
+	Checksums bool
+	// AllowOrigin decides whether a WebSocket handshake with an Origin header is accepted. Browsers do
+	// not apply CORS to WebSockets, so nil accepts only requests whose Origin host is the request host.
+	// Requests without an Origin header (not sent by a browser) are always accepted.
+	AllowOrigin func(r *http.Request) bool
+	// TruncateLog truncates the log of the document to the last MaxLag versions as changes are streamed.
+	// Older versions are not needed by the server: a client that falls further behind gets a snapshot.
+	// Without it the log grows until the owner of the document truncates or compacts it.
+	TruncateLog bool
+}
+
+// Server streams a SharedDocument to its clients.
+//
+// A client opens a stream with GET: WebSocket when the request is an upgrade, Server-Sent Events
+// otherwise. The "client" query parameter identifies it (the server generates one if it is empty)
+// and "version" lets a reconnecting client resume from the version it already has.
+// The first message is a snapshot, or a change computed with Difference when resuming.
+// Acks and resync requests are sent as Messages: over the WebSocket, or with POST for SSE streams.
+type Server struct {
+	document      *cofly.SharedDocument
+	maxLag        int
+	isChecksums   bool
+	allowOrigin   func(r *http.Request) bool
+	isTruncateLog bool
+
+	mutex     gosync.Mutex
+	sessions  map[string]*session
+	checksums map[uint64]string
+	// truncatedVersion is the version the log was last truncated to.
+	truncatedVersion uint64
+}
+
+type session struct {
+	control chan Message
+}
+
+func NewServer(document *cofly.SharedDocument, options ServerOptions) *Server {
+	if options.MaxLag <= 0 {
+		options.MaxLag = defaultMaxLag
+	}
+
+	if options.AllowOrigin == nil {
+		options.AllowOrigin = isSameOrigin
+	}
+
+	return &Server{
+		document:      document,
+		maxLag:        options.MaxLag,
+		isChecksums:   options.Checksums,
+		allowOrigin:   options.AllowOrigin,
+		isTruncateLog: options.TruncateLog,
+		sessions:      map[string]*session{},
+		checksums:     map[uint64]string{},
+	}
+}
+
+type messageSender interface {
+	send(message Message) error
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.serveStream(w, r)
+	case http.MethodPost:
+		s.serveControl(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	clientID := query.Get("client")
+	if clientID == "" {
+		clientID = newClientID()
+	}
+
+	var since *uint64
+	if value := query.Get("version"); value != "" {
+		version, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+		since = &version
+	}
+
+	if isWebSocketRequest(r) {
+		if r.Header.Get("Origin") != "" && !s.allowOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		conn, err := acceptWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		session := s.openSession(clientID)
+		defer s.closeSession(clientID, session)
+
+		go func() {
+			defer cancel()
+
+			for {
+				message, err := conn.receive()
+				if err != nil {
+					return
+				}
+
+				select {
+				case session.control <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		s.stream(ctx, clientID, since, session, conn)
+		return
+	}
+
+	writer, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := s.openSession(clientID)
+	defer s.closeSession(clientID, session)
+
+	s.stream(r.Context(), clientID, since, session, writer)
+}
+
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	var message Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&message); err != nil {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+
+	if message.Client == "" {
+		message.Client = r.URL.Query().Get("client")
+	}
+
+	s.mutex.Lock()
+	session := s.sessions[message.Client]
+	s.mutex.Unlock()
+
+	if session == nil {
+		http.Error(w, "unknown client", http.StatusNotFound)
+		return
+	}
+
+	select {
+	case session.control <- message:
+		w.WriteHeader(http.StatusAccepted)
+	case <-r.Context().Done():
+	}
+}
+
+// openSession registers a stream; a newer stream of the same client replaces the older one.
+func (s *Server) openSession(clientID string) *session {
+	session := &session{control: make(chan Message, 16)}
+
+	s.mutex.Lock()
+	s.sessions[clientID] = session
+	s.mutex.Unlock()
+
+	return session
+}
+
+func (s *Server) closeSession(clientID string, session *session) {
+	s.mutex.Lock()
+	if s.sessions[clientID] == session {
+		delete(s.sessions, clientID)
+	}
+	s.mutex.Unlock()
+}
+
+func (s *Server) stream(ctx context.Context, clientID string, since *uint64, session *session, sender messageSender) {
+	subscription := s.document.Subscribe(s.maxLag, cofly.BackpressureDrop)
+	defer func() { subscription.Close() }()
+
+	sentVersion := subscription.Version
+	ackedVersion := sentVersion
+
+	var first Message
+	if since != nil && *since <= sentVersion {
+		if old, err := s.document.Snapshot(*since); err == nil {
+			first = Message{
+				Type:            MessageChange,
+				PreviousVersion: *since,
+				Version:         sentVersion,
+				Value:           cofly.Change{Value: cofly.Difference(old, subscription.Snapshot)},
+			}
+			ackedVersion = *since
+		}
+	}
+
+	if first.Type == "" {
+		first = Message{Type: MessageSnapshot, Version: sentVersion, Value: cofly.Change{Value: subscription.Snapshot}}
+	}
+
+	first.Client = clientID
+	if err := s.send(sender, first); err != nil {
+		return
+	}
+
+	// resync sends a snapshot from a new subscription, so that no update is lost in between.
+	resync := func() error {
+		subscription.Close()
+		subscription = s.document.Subscribe(s.maxLag, cofly.BackpressureDrop)
+		sentVersion, ackedVersion = subscription.Version, subscription.Version
+
+		return s.send(sender, Message{
+			Type:    MessageSnapshot,
+			Client:  clientID,
+			Version: sentVersion,
+			Value:   cofly.Change{Value: subscription.Snapshot},
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-subscription.Updates:
+			if !ok {
+				return
+			}
+
+			s.truncateLog(update.Version)
+
+			var err error
+			if update.PreviousVersion != sentVersion || update.Version-ackedVersion > uint64(s.maxLag) {
+				err = resync()
+			} else {
+				err = s.send(sender, Message{
+					Type:            MessageChange,
+					Client:          clientID,
+					PreviousVersion: update.PreviousVersion,
+					Version:         update.Version,
+					Value:           cofly.Change{Value: update.Change},
+				})
+				sentVersion = update.Version
+			}
+
+			if err != nil {
+				return
+			}
+		case message := <-session.control:
+			switch message.Type {
+			case MessageAck:
+				if ackedVersion < message.Version && message.Version <= sentVersion {
+					ackedVersion = message.Version
+				}
+			case MessageResync:
+				if err := resync(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) send(sender messageSender, message Message) error {
+	if s.isChecksums {
+		message.Checksum = s.checksum(message)
+	}
+
+	return sender.send(message)
+}
+
+// checksum returns the checksum of the value at message.Version. Checksums are shared by the
+// sessions and only kept for the last MaxLag versions.
+func (s *Server) checksum(message Message) string {
+	s.mutex.Lock()
+	checksum, ok := s.checksums[message.Version]
+	s.mutex.Unlock()
+
+	if ok {
+		return checksum
+	}
+
+	var err error
+
+	if message.Type == MessageSnapshot {
+		checksum, err = cofly.TryChecksum(message.Value.Value)
+	} else {
+		isRead := false
+
+		s.document.Read(func(value any, version uint64) {
+			if version == message.Version {
+				checksum, err = cofly.TryChecksum(value)
+				isRead = true
+			}
+		})
+
+		if !isRead {
+			value, snapshotErr := s.document.Snapshot(message.Version)
+			if snapshotErr != nil {
+				return ""
+			}
+
+			checksum, err = cofly.TryChecksum(value)
+		}
+	}
+
+	// Values that cannot be hashed are sent without a checksum, which clients do not verify.
+	if err != nil {
+		checksum = ""
+	}
+
+	s.mutex.Lock()
+	s.checksums[message.Version] = checksum
+	for version := range s.checksums {
+		if version+uint64(s.maxLag) < message.Version {
+			delete(s.checksums, version)
+		}
+	}
+	s.mutex.Unlock()
+
+	return checksum
+}
+
+// truncateLog keeps the last MaxLag versions in the log. It truncates once every MaxLag versions,
+// since truncating copies the value at the new base version.
+func (s *Server) truncateLog(version uint64) {
+	if !s.isTruncateLog {
+		return
+	}
+
+	s.mutex.Lock()
+	if version < s.truncatedVersion+2*uint64(s.maxLag) {
+		s.mutex.Unlock()
+		return
+	}
+	s.truncatedVersion = version - uint64(s.maxLag)
+	truncatedVersion := s.truncatedVersion
+	s.mutex.Unlock()
+
+	// The owner of the document may have truncated or compacted it further.
+	_ = s.document.Truncate(truncatedVersion)
+}
+
+func newClientID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,282 @@
+package sync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnkv/cofly-go"
+	"github.com/rnkv/cofly-go/sync"
+)
+
+// label is a Differ, which cannot be hashed, that encodes as a string.
+type label string
+
+func (l label) CoflyEqual(other any) bool {
+	return other == l
+}
+
+func (l label) CoflyDiff(old any) any {
+	return l
+}
+
+func (l label) CoflyMerge(change any) any {
+	return change
+}
+
+func (l label) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(l))
+}
+
+func TestServer(t *testing.T) {
+	transports := map[string]func(serverURL string) string{
+		"sse":       func(serverURL string) string { return serverURL },
+		"websocket": func(serverURL string) string { return "ws" + strings.TrimPrefix(serverURL, "http") },
+	}
+
+	for name, streamURL := range transports {
+		t.Run(name, func(t *testing.T) {
+			newServer := func(t *testing.T, options sync.ServerOptions) (*cofly.SharedDocument, string) {
+				t.Helper()
+
+				document := cofly.NewSharedDocument(map[string]any{"count": 0, "list": []any{"a"}})
+				server := httptest.NewServer(sync.NewServer(document, options))
+				t.Cleanup(server.Close)
+
+				return document, streamURL(server.URL)
+			}
+
+			dial := func(t *testing.T, url string, options sync.ClientOptions) *sync.Client {
+				t.Helper()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				client, err := sync.Dial(ctx, url, options)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				t.Cleanup(func() { client.Close() })
+
+				return client
+			}
+
+			receive := func(t *testing.T, client *sync.Client) sync.Message {
+				t.Helper()
+
+				message, err := client.Receive()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if message.Client != client.ID() {
+					t.Fatalf("expected client %q, got %q", client.ID(), message.Client)
+				}
+
+				return message
+			}
+
+			apply := func(t *testing.T, document *cofly.SharedDocument, change any) {
+				t.Helper()
+
+				if _, err := document.Apply(change); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			t.Run("snapshot-then-changes", func(t *testing.T) {
+				document, url := newServer(t, sync.ServerOptions{})
+				client := dial(t, url, sync.ClientOptions{})
+
+				snapshot := receive(t, client)
+				if snapshot.Type != sync.MessageSnapshot || snapshot.Version != 0 {
+					t.Fatalf("unexpected message %#v", snapshot)
+				}
+
+				apply(t, document, map[string]any{"count": cofly.Increment(1)})
+				apply(t, document, map[string]any{"list": map[string]any{"1..": []any{"b"}}, "gone": cofly.Undefined})
+
+				value := snapshot.Value.Value
+				version := snapshot.Version
+
+				for range 2 {
+					message := receive(t, client)
+					if message.Type != sync.MessageChange || message.PreviousVersion != version {
+						t.Fatalf("unexpected message %#v", message)
+					}
+
+					value = cofly.Merge(value, message.Value.Value, true)
+					version = message.Version
+
+					if err := client.Ack(context.Background(), version); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+
+				if version != 2 || !cofly.Equal(value, document.Value()) {
+					t.Fatalf("expected %#v at 2, got %#v at %d", document.Value(), value, version)
+				}
+			})
+
+			t.Run("resync-on-request", func(t *testing.T) {
+				document, url := newServer(t, sync.ServerOptions{})
+				client := dial(t, url, sync.ClientOptions{})
+				receive(t, client)
+
+				apply(t, document, map[string]any{"count": 5})
+				receive(t, client)
+
+				if err := client.Resync(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				message := receive(t, client)
+				if message.Type != sync.MessageSnapshot || message.Version != 1 || !cofly.Equal(message.Value.Value, document.Value()) {
+					t.Fatalf("unexpected message %#v", message)
+				}
+			})
+
+			t.Run("resync-when-too-far-behind", func(t *testing.T) {
+				document, url := newServer(t, sync.ServerOptions{MaxLag: 2})
+				client := dial(t, url, sync.ClientOptions{})
+				receive(t, client)
+
+				for value := range 3 {
+					apply(t, document, map[string]any{"count": value + 1})
+				}
+
+				types := []string{receive(t, client).Type, receive(t, client).Type, receive(t, client).Type}
+				if want := []string{sync.MessageChange, sync.MessageChange, sync.MessageSnapshot}; !reflect.DeepEqual(types, want) {
+					t.Fatalf("expected %v, got %v", want, types)
+				}
+			})
+
+			t.Run("truncate-log", func(t *testing.T) {
+				document, url := newServer(t, sync.ServerOptions{MaxLag: 2, TruncateLog: true})
+				client := dial(t, url, sync.ClientOptions{})
+				receive(t, client)
+
+				for value := range 10 {
+					apply(t, document, map[string]any{"count": value + 1})
+
+					message := receive(t, client)
+					if err := client.Ack(context.Background(), message.Version); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+
+				if _, err := document.ChangesSince(0); !errors.Is(err, cofly.ErrVersionCompacted) {
+					t.Fatalf("expected ErrVersionCompacted, got %v", err)
+				}
+				if changes, err := document.ChangesSince(8); err != nil || len(changes) != 2 {
+					t.Fatalf("expected the last 2 changes, got %#v, %v", changes, err)
+				}
+			})
+
+			t.Run("resume-from-version", func(t *testing.T) {
+				document, url := newServer(t, sync.ServerOptions{})
+				old := document.Value()
+
+				apply(t, document, map[string]any{"count": 1})
+				apply(t, document, map[string]any{"list": map[string]any{"0..1": []any{}}})
+
+				client := dial(t, url, sync.ClientOptions{Version: 1})
+
+				message := receive(t, client)
+				if message.Type != sync.MessageChange || message.PreviousVersion != 1 || message.Version != 2 {
+					t.Fatalf("unexpected message %#v", message)
+				}
+
+				old = cofly.Merge(old, map[string]any{"count": 1}, true)
+				if got := cofly.Merge(old, message.Value.Value, true); !cofly.Equal(got, document.Value()) {
+					t.Fatalf("expected %#v, got %#v", document.Value(), got)
+				}
+			})
+		})
+	}
+
+	t.Run("websocket-origin", func(t *testing.T) {
+		dial := func(t *testing.T, options sync.ServerOptions, origin string) error {
+			t.Helper()
+
+			server := httptest.NewServer(sync.NewServer(cofly.NewSharedDocument(nil), options))
+			t.Cleanup(server.Close)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			header := http.Header{}
+			if origin != "" {
+				header.Set("Origin", strings.ReplaceAll(origin, "SERVER", strings.TrimPrefix(server.URL, "http://")))
+			}
+
+			client, err := sync.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), sync.ClientOptions{Header: header})
+			if err == nil {
+				client.Close()
+			}
+
+			return err
+		}
+
+		if err := dial(t, sync.ServerOptions{}, ""); err != nil {
+			t.Fatalf("unexpected error without origin: %v", err)
+		}
+		if err := dial(t, sync.ServerOptions{}, "http://SERVER"); err != nil {
+			t.Fatalf("unexpected error for same origin: %v", err)
+		}
+		if err := dial(t, sync.ServerOptions{}, "https://evil.example"); err == nil {
+			t.Fatalf("expected cross-origin handshake to fail")
+		}
+
+		allowAll := func(*http.Request) bool { return true }
+		if err := dial(t, sync.ServerOptions{AllowOrigin: allowAll}, "https://evil.example"); err != nil {
+			t.Fatalf("unexpected error with AllowOrigin: %v", err)
+		}
+	})
+
+	t.Run("unhashable-values-are-sent-without-checksums", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{"name": label("a")})
+		server := httptest.NewServer(sync.NewServer(document, sync.ServerOptions{Checksums: true}))
+		defer server.Close()
+
+		client, err := sync.Dial(context.Background(), server.URL, sync.ClientOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer client.Close()
+
+		if _, err := document.Apply(map[string]any{"count": 1}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, messageType := range []string{sync.MessageSnapshot, sync.MessageChange} {
+			message, err := client.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if message.Type != messageType || message.Checksum != "" {
+				t.Fatalf("expected a %s without a checksum, got %#v", messageType, message)
+			}
+		}
+	})
+
+	t.Run("ack-for-unknown-client", func(t *testing.T) {
+		server := httptest.NewServer(sync.NewServer(cofly.NewSharedDocument(nil), sync.ServerOptions{}))
+		defer server.Close()
+
+		response, err := http.Post(server.URL, "application/json", strings.NewReader(`{"type":"ack","client":"nobody","version":1}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected 404, got %s", response.Status)
+		}
+	})
+}
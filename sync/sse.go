@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type sseWriter struct {
+	writer  http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{writer: w, flusher: flusher}, nil
+}
+
+func (w *sseWriter) send(message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w.writer, "event: %s\ndata: %s\n\n", message.Type, data); err != nil {
+		return err
+	}
+
+	w.flusher.Flush()
+	return nil
+}
+
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+
+	return &sseReader{scanner: scanner}
+}
+
+// receive returns the next event. Only the data field is used: the event name repeats Message.Type.
+func (r *sseReader) receive() (Message, error) {
+	var data bytes.Buffer
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+
+			var message Message
+			if err := json.Unmarshal(data.Bytes(), &message); err != nil {
+				return Message{}, err
+			}
+
+			return message, nil
+		}
+
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Message{}, err
+	}
+
+	return Message{}, io.EOF
+}
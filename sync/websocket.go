@@ -0,0 +1,362 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// websocketGUID is appended to the handshake key (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	websocketContinuation = 0x0
+	websocketText         = 0x1
+	websocketBinary       = 0x2
+	websocketClose        = 0x8
+	websocketPing         = 0x9
+	websocketPong         = 0xa
+)
+
+const maxWebSocketMessageSize = 64 << 20
+
+// websocketConn is a minimal RFC 6455 connection that exchanges Messages as text frames.
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// isClient connections mask the frames they send and expect unmasked frames back.
+	isClient bool
+
+	writeMutex gosync.Mutex
+}
+
+func isWebSocketRequest(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isSameOrigin reports whether the host of the Origin header is the request host.
+func isSameOrigin(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(origin.Host, r.Host)
+}
+
+func websocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("invalid websocket handshake")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("websocket unsupported")
+	}
+
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(buffer,
+		"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		websocketAccept(key),
+	)
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &websocketConn{conn: conn, reader: buffer.Reader}, nil
+}
+
+func dialWebSocket(ctx context.Context, rawURL string, header http.Header) (*websocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			address = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		conn, err = (&tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	websocket, err := handshakeWebSocket(ctx, conn, u, header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return websocket, nil
+}
+
+func handshakeWebSocket(ctx context.Context, conn net.Conn, u *url.URL, header http.Header) (*websocketConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	requestURL := *u
+	requestURL.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := request.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket handshake failed: %s", response.Status)
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, errors.New("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+
+	return &websocketConn{conn: conn, reader: reader, isClient: true}, nil
+}
+
+func (c *websocketConn) send(message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return c.writeFrame(websocketText, data)
+}
+
+// receive returns the next text message, answering pings on the way.
+// A close frame is reported as io.EOF.
+func (c *websocketConn) receive() (Message, error) {
+	var data []byte
+	isFragmented := false
+
+	for {
+		isFinal, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return Message{}, err
+		}
+
+		switch opcode {
+		case websocketPing:
+			if err := c.writeFrame(websocketPong, payload); err != nil {
+				return Message{}, err
+			}
+			continue
+		case websocketPong:
+			continue
+		case websocketClose:
+			c.writeFrame(websocketClose, nil)
+			return Message{}, io.EOF
+		case websocketText, websocketBinary:
+			if isFragmented {
+				return Message{}, errors.New("websocket: unexpected data frame inside a fragmented message")
+			}
+			data = payload
+		case websocketContinuation:
+			if !isFragmented {
+				return Message{}, errors.New("websocket: unexpected continuation frame")
+			}
+			data = append(data, payload...)
+		default:
+			return Message{}, fmt.Errorf("websocket: unsupported opcode %d", opcode)
+		}
+
+		if len(data) > maxWebSocketMessageSize {
+			return Message{}, errors.New("websocket: message too large")
+		}
+
+		if !isFinal {
+			isFragmented = true
+			continue
+		}
+
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			return Message{}, err
+		}
+
+		return message, nil
+	}
+}
+
+func (c *websocketConn) readFrame() (isFinal bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	isFinal = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	isMasked := header[1]&0x80 != 0
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket: reserved bits set")
+	}
+
+	if isMasked == c.isClient {
+		return false, 0, nil, errors.New("websocket: invalid frame masking")
+	}
+
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if length > maxWebSocketMessageSize {
+		return false, 0, nil, errors.New("websocket: frame too large")
+	}
+
+	var mask [4]byte
+	if isMasked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	if isMasked {
+		for index := range payload {
+			payload[index] ^= mask[index%4]
+		}
+	}
+
+	return isFinal, opcode, payload, nil
+}
+
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+
+	maskBit := byte(0)
+	if c.isClient {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(length))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(length))
+	}
+
+	if c.isClient {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+
+		frame = append(frame, mask[:]...)
+		for index, b := range payload {
+			frame = append(frame, b^mask[index%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *websocketConn) close() error {
+	c.writeFrame(websocketClose, nil)
+	return c.conn.Close()
+}
@@ -0,0 +1,204 @@
+package cofly
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Tracker holds a value and records the paths written through it, so that Difference
+// against the last returned state only compares the subtrees that were written.
+// It is not safe for concurrent use.
+type Tracker struct {
+	options DifferenceOptions
+	current any
+	sent    any
+	dirty   *dirtyNode
+}
+
+// dirtyNode is a trie of written paths. A dirty node covers its whole subtree.
+type dirtyNode struct {
+	isDirty  bool
+	children map[string]*dirtyNode
+}
+
+func NewTracker(value any, options DifferenceOptions) *Tracker {
+	options.parseUnorderedPaths()
+
+	return &Tracker{
+		options: options,
+		current: value,
+		sent:    Clone(value),
+		dirty:   &dirtyNode{},
+	}
+}
+
+// Value returns the current value without copying it. Modifying it in place
+// must be followed by MarkDirty.
+func (t *Tracker) Value() any {
+	return t.current
+}
+
+// MarkDirty records that the value at the path was modified outside the Tracker.
+func (t *Tracker) MarkDirty(path string) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	t.dirty.mark(segments)
+	return nil
+}
+
+// Merge merges the change into the value in place. If the change is invalid the value may be
+// partially updated; the whole value is then compared by the next Difference.
+func (t *Tracker) Merge(change any, doClean bool) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			t.dirty.mark(nil)
+			err = fmt.Errorf("%w: %v", ErrInvalidChange, recovered)
+		}
+	}()
+
+	t.current = Merge(t.current, change, doClean)
+	t.dirty.markChange(change, nil)
+
+	return nil
+}
+
+// Set replaces the value at the path; Undefined deletes a map key.
+// The parent must be an existing map, or an array with the index in range.
+func (t *Tracker) Set(path string, value any) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		t.current = value
+		t.dirty.mark(nil)
+		return nil
+	}
+
+	parent := t.current
+	for _, segment := range segments[:len(segments)-1] {
+		parent = childValue(parent, segment)
+	}
+
+	key := segments[len(segments)-1]
+
+	switch parent := parent.(type) {
+	case map[string]any:
+		if value == Undefined {
+			delete(parent, key)
+		} else {
+			parent[key] = value
+		}
+	case []any:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(parent) || value == Undefined {
+			return fmt.Errorf("invalid path %q: cannot set array element %q", path, key)
+		}
+
+		parent[index] = value
+	default:
+		return fmt.Errorf("invalid path %q: parent is not a map or an array", path)
+	}
+
+	t.dirty.mark(segments)
+	return nil
+}
+
+// Difference returns the change from the state returned by the previous call (or the initial value)
+// to the current value, comparing only the written subtrees. The change may share values with Value.
+func (t *Tracker) Difference() any {
+	change := t.difference(t.sent, t.current, t.dirty, nil)
+
+	if change != Undefined {
+		t.sent = Merge(t.sent, Clone(change), true)
+	}
+
+	t.dirty = &dirtyNode{}
+	return change
+}
+
+func (t *Tracker) difference(sent, current any, node *dirtyNode, path []string) any {
+	if node.isDirty {
+		return t.options.difference(sent, current, path)
+	}
+
+	sentMap, isSentMap := sent.(map[string]any)
+	currentMap, isCurrentMap := current.(map[string]any)
+
+	if !isSentMap || !isCurrentMap || sentMap == nil || currentMap == nil {
+		if len(node.children) == 0 {
+			return Undefined
+		}
+
+		// Writes below an array (or a value that changed type) compare the whole value.
+		return t.options.difference(sent, current, path)
+	}
+
+	changes := make(map[string]any)
+
+	for key, child := range node.children {
+		sentValue, doesSentKeyExist := sentMap[key]
+		currentValue, doesCurrentKeyExist := currentMap[key]
+
+		switch {
+		case doesSentKeyExist && doesCurrentKeyExist:
+			if change := t.difference(sentValue, currentValue, child, append(path[:len(path):len(path)], key)); change != Undefined {
+				changes[key] = change
+			}
+		case doesSentKeyExist:
+			changes[key] = Undefined
+		case doesCurrentKeyExist:
+			changes[key] = currentValue
+		}
+	}
+
+	if len(changes) == 0 {
+		return Undefined
+	}
+
+	return changes
+}
+
+func (n *dirtyNode) mark(path []string) {
+	for _, segment := range path {
+		if n.isDirty {
+			return
+		}
+
+		if n.children == nil {
+			n.children = make(map[string]*dirtyNode)
+		}
+
+		child, ok := n.children[segment]
+		if !ok {
+			child = &dirtyNode{}
+			n.children[segment] = child
+		}
+
+		n = child
+	}
+
+	n.isDirty = true
+	n.children = nil
+}
+
+// markChange marks the paths a change writes: object changes are followed key by key,
+// anything else marks its own path.
+func (n *dirtyNode) markChange(change any, path []string) {
+	changeMap, isChangeMap := change.(map[string]any)
+
+	if !isChangeMap || changeMap == nil || isOperationMap(changeMap) {
+		if change != Undefined || len(path) > 0 {
+			n.mark(path)
+		}
+		return
+	}
+
+	for key, value := range changeMap {
+		n.markChange(value, append(path[:len(path):len(path)], key))
+	}
+}
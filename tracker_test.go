@@ -0,0 +1,113 @@
+package cofly_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestTracker(t *testing.T) {
+	newState := func() map[string]any {
+		return map[string]any{
+			"rooms": map[string]any{
+				"lobby": map[string]any{"players": []any{"ann"}, "score": 1},
+				"arena": map[string]any{"players": []any{"bob"}, "score": 2},
+			},
+			"tick": 0,
+		}
+	}
+
+	t.Run("only-written-paths-are-compared", func(t *testing.T) {
+		tracker := cofly.NewTracker(newState(), cofly.DifferenceOptions{})
+
+		if err := tracker.Set("/tick", 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Modified in place without MarkDirty, so the tracker does not see it.
+		tracker.Value().(map[string]any)["rooms"].(map[string]any)["arena"].(map[string]any)["score"] = 5
+
+		if change := tracker.Difference(); !reflect.DeepEqual(change, map[string]any{"tick": 1}) {
+			t.Fatalf("unexpected change %#v", change)
+		}
+
+		if err := tracker.MarkDirty("/rooms/arena"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := map[string]any{"rooms": map[string]any{"arena": map[string]any{"score": 5}}}
+		if change := tracker.Difference(); !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+
+		if change := tracker.Difference(); change != cofly.Undefined {
+			t.Fatalf("expected no change, got %#v", change)
+		}
+	})
+
+	t.Run("changes-replay-to-current-value", func(t *testing.T) {
+		tracker := cofly.NewTracker(newState(), cofly.DifferenceOptions{})
+		replica := any(newState())
+
+		steps := []func() error{
+			func() error {
+				return tracker.Merge(map[string]any{"rooms": map[string]any{"lobby": map[string]any{
+					"players": map[string]any{"1..": []any{"cat"}},
+				}}}, true)
+			},
+			func() error { return tracker.Set("/rooms/arena", cofly.Undefined) },
+			func() error { return tracker.Set("/rooms/hall", map[string]any{"players": []any{}}) },
+			func() error { return tracker.Set("/rooms/lobby/players/0", "dan") },
+			func() error { return tracker.Merge(map[string]any{"tick": cofly.Increment(3)}, true) },
+			func() error { return tracker.Set("", map[string]any{"tick": 9}) },
+		}
+
+		for index, step := range steps {
+			if err := step(); err != nil {
+				t.Fatalf("step %d: unexpected error: %v", index, err)
+			}
+
+			change := tracker.Difference()
+			if change != cofly.Undefined {
+				replica = cofly.Merge(replica, cofly.Clone(change), true)
+			}
+
+			if !reflect.DeepEqual(replica, tracker.Value()) {
+				t.Fatalf("step %d: expected %#v, got %#v", index, tracker.Value(), replica)
+			}
+		}
+	})
+
+	t.Run("matches-difference", func(t *testing.T) {
+		options := cofly.DifferenceOptions{Increments: true}
+		tracker := cofly.NewTracker(newState(), options)
+
+		if err := tracker.Merge(map[string]any{"rooms": map[string]any{"lobby": map[string]any{"score": 4}}}, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := cofly.DifferenceWithOptions(newState(), tracker.Value(), options)
+		if change := tracker.Difference(); !reflect.DeepEqual(change, want) {
+			t.Fatalf("expected %#v, got %#v", want, change)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tracker := cofly.NewTracker(newState(), cofly.DifferenceOptions{})
+
+		for _, path := range []string{"rooms", "/missing/key", "/tick/x", "/rooms/lobby/players/1"} {
+			if err := tracker.Set(path, 1); err == nil {
+				t.Fatalf("expected error for %q", path)
+			}
+		}
+
+		err := tracker.Merge(map[string]any{"rooms": map[string]any{"lobby": map[string]any{
+			"players": map[string]any{"5..": []any{"x"}},
+		}}}, true)
+		if !errors.Is(err, cofly.ErrInvalidChange) {
+			t.Fatalf("expected ErrInvalidChange, got %v", err)
+		}
+	})
+}
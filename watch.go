@@ -0,0 +1,169 @@
+package cofly
+
+import (
+	"slices"
+	"strconv"
+)
+
+type watcher struct {
+	pattern []string
+	fn      func(path string, change any)
+}
+
+// Watch calls fn for every applied change that touches a path matching the pattern,
+// a JSON Pointer in which "*" matches any single segment (for example "/rooms/*/players").
+// fn receives the concrete path and the change for the value at that path (Undefined when it was deleted).
+// Callbacks run one at a time after the change is applied; they must not call Apply.
+func (d *SharedDocument) Watch(pattern string, fn func(path string, change any)) (cancel func(), err error) {
+	segments, err := parsePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher := &watcher{pattern: segments, fn: fn}
+
+	d.publishMutex.Lock()
+	d.watchers[watcher] = struct{}{}
+	d.publishMutex.Unlock()
+
+	return func() {
+		d.publishMutex.Lock()
+		delete(d.watchers, watcher)
+		d.publishMutex.Unlock()
+	}, nil
+}
+
+// notify is called with the publish lock held.
+func (w *watcher) notify(oldValue, newValue, change any) {
+	collectPathChanges(oldValue, newValue, change, w.pattern, nil, func(path []string, change any) {
+		w.fn(formatPath(path), Clone(change))
+	})
+}
+
+// collectPathChanges walks the change along the pattern. While the change is an object change,
+// only the keys it mentions are visited; below a replacement or a splice-map the sub-changes are
+// computed from the old and new values.
+func collectPathChanges(oldValue, newValue, change any, pattern, path []string, visit func(path []string, change any)) {
+	if len(pattern) == 0 {
+		visit(path, change)
+		return
+	}
+
+	changeMap, isChangeMap := change.(map[string]any)
+	oldMap, isOldMap := oldValue.(map[string]any)
+	newMap, isNewMap := newValue.(map[string]any)
+
+	if !isChangeMap || changeMap == nil || isOperationMap(changeMap) || !isOldMap || !isNewMap {
+		collectPathDifferences(oldValue, newValue, pattern, path, visit)
+		return
+	}
+
+	for _, key := range matchingKeys(pattern[0], sortedKeys(changeMap)) {
+		childPath := append(slices.Clip(path), key)
+		oldChild, newChild := childValue(oldMap, key), childValue(newMap, key)
+
+		if changeMap[key] == Undefined {
+			collectPathDifferences(oldChild, newChild, pattern[1:], childPath, visit)
+			continue
+		}
+
+		collectPathChanges(oldChild, newChild, changeMap[key], pattern[1:], childPath, visit)
+	}
+}
+
+// collectPathDifferences visits the paths matching the pattern whose values differ.
+// Missing values are represented by Undefined.
+func collectPathDifferences(oldValue, newValue any, pattern, path []string, visit func(path []string, change any)) {
+	if oldValue != Undefined && newValue != Undefined && Equal(oldValue, newValue) {
+		return
+	}
+
+	if len(pattern) == 0 {
+		switch {
+		case newValue == Undefined:
+			visit(path, Undefined)
+		case oldValue == Undefined:
+			visit(path, newValue)
+		default:
+			visit(path, Difference(oldValue, newValue))
+		}
+
+		return
+	}
+
+	keys := childKeys(oldValue)
+
+	oldKeys := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		oldKeys[key] = struct{}{}
+	}
+
+	for _, key := range childKeys(newValue) {
+		if _, ok := oldKeys[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range matchingKeys(pattern[0], keys) {
+		collectPathDifferences(
+			childValue(oldValue, key),
+			childValue(newValue, key),
+			pattern[1:],
+			append(slices.Clip(path), key),
+			visit,
+		)
+	}
+}
+
+func matchingKeys(segment string, keys []string) []string {
+	if segment == "*" {
+		return keys
+	}
+
+	if slices.Contains(keys, segment) {
+		return []string{segment}
+	}
+
+	return nil
+}
+
+// childKeys returns the keys of a map in sorted order, or the indexes of an array.
+func childKeys(value any) []string {
+	switch value := value.(type) {
+	case map[string]any:
+		return sortedKeys(value)
+	case []any:
+		keys := make([]string, len(value))
+		for index := range value {
+			keys[index] = strconv.Itoa(index)
+		}
+		return keys
+	default:
+		return nil
+	}
+}
+
+func childValue(value any, key string) any {
+	switch value := value.(type) {
+	case map[string]any:
+		if child, ok := value[key]; ok {
+			return child
+		}
+	case []any:
+		if index, err := strconv.Atoi(key); err == nil && 0 <= index && index < len(value) && strconv.Itoa(index) == key {
+			return value[index]
+		}
+	}
+
+	return Undefined
+}
+
+func sortedKeys(value map[string]any) []string {
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
@@ -0,0 +1,144 @@
+package cofly_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rnkv/cofly-go"
+)
+
+func TestWatch(t *testing.T) {
+	type notification struct {
+		Path   string
+		Change any
+	}
+
+	watch := func(t *testing.T, document *cofly.SharedDocument, pattern string) *[]notification {
+		t.Helper()
+
+		notifications := &[]notification{}
+		cancel, err := document.Watch(pattern, func(path string, change any) {
+			*notifications = append(*notifications, notification{path, change})
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(cancel)
+
+		return notifications
+	}
+
+	apply := func(t *testing.T, document *cofly.SharedDocument, change any) {
+		t.Helper()
+
+		if _, err := document.Apply(change); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	newDocument := func() *cofly.SharedDocument {
+		return cofly.NewSharedDocument(map[string]any{
+			"rooms": map[string]any{
+				"lobby": map[string]any{"players": []any{"ann"}, "topic": "hi"},
+				"arena": map[string]any{"players": []any{}},
+			},
+			"score": 0,
+		})
+	}
+
+	t.Run("wildcard-receives-sub-changes", func(t *testing.T) {
+		document := newDocument()
+		notifications := watch(t, document, "/rooms/*/players")
+
+		apply(t, document, map[string]any{
+			"rooms": map[string]any{
+				"lobby": map[string]any{"topic": "bye"},
+				"arena": map[string]any{"players": map[string]any{"0..": []any{"bob"}}},
+			},
+			"score": 1,
+		})
+
+		want := []notification{{"/rooms/arena/players", map[string]any{"0..": []any{"bob"}}}}
+		if !reflect.DeepEqual(*notifications, want) {
+			t.Fatalf("expected %#v, got %#v", want, *notifications)
+		}
+	})
+
+	t.Run("unrelated-changes-are-ignored", func(t *testing.T) {
+		document := newDocument()
+		notifications := watch(t, document, "/rooms/*/players")
+
+		apply(t, document, map[string]any{"score": cofly.Increment(1)})
+		apply(t, document, map[string]any{"rooms": map[string]any{"lobby": map[string]any{"topic": "x"}}})
+
+		if len(*notifications) != 0 {
+			t.Fatalf("unexpected notifications %#v", *notifications)
+		}
+	})
+
+	t.Run("replaced-and-deleted-parents", func(t *testing.T) {
+		document := newDocument()
+		notifications := watch(t, document, "/rooms/*/players")
+
+		apply(t, document, map[string]any{
+			"rooms": map[string]any{
+				"lobby": cofly.Undefined,
+				"arena": map[string]any{"players": []any{"cat"}},
+				"attic": map[string]any{"players": []any{"dan"}},
+			},
+		})
+		apply(t, document, map[string]any{"rooms": map[string]any{"hall": map[string]any{"players": []any{"eve"}}}})
+		apply(t, document, map[string]any{"rooms": []any{}})
+
+		want := []notification{
+			{"/rooms/arena/players", []any{"cat"}},
+			{"/rooms/attic/players", []any{"dan"}},
+			{"/rooms/lobby/players", cofly.Undefined},
+			{"/rooms/hall/players", []any{"eve"}},
+			{"/rooms/arena/players", cofly.Undefined},
+			{"/rooms/attic/players", cofly.Undefined},
+			{"/rooms/hall/players", cofly.Undefined},
+		}
+		if !reflect.DeepEqual(*notifications, want) {
+			t.Fatalf("expected %#v, got %#v", want, *notifications)
+		}
+	})
+
+	t.Run("array-elements-inside-splices", func(t *testing.T) {
+		document := cofly.NewSharedDocument(map[string]any{
+			"items": []any{map[string]any{"n": 1}, map[string]any{"n": 2}},
+		})
+		notifications := watch(t, document, "/items/*/n")
+
+		apply(t, document, map[string]any{"items": map[string]any{"1..2": []any{map[string]any{"n": 3}}}})
+
+		want := []notification{{"/items/1/n", 3}}
+		if !reflect.DeepEqual(*notifications, want) {
+			t.Fatalf("expected %#v, got %#v", want, *notifications)
+		}
+	})
+
+	t.Run("cancel-and-invalid-pattern", func(t *testing.T) {
+		document := newDocument()
+
+		notifications := []string{}
+		cancel, err := document.Watch("/score", func(path string, change any) {
+			notifications = append(notifications, path)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		apply(t, document, map[string]any{"score": 1})
+		cancel()
+		apply(t, document, map[string]any{"score": 2})
+
+		if !reflect.DeepEqual(notifications, []string{"/score"}) {
+			t.Fatalf("unexpected notifications %#v", notifications)
+		}
+
+		if _, err := document.Watch("rooms", func(string, any) {}); err == nil {
+			t.Fatalf("expected error for pattern without leading slash")
+		}
+	})
+}